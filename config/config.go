@@ -9,7 +9,6 @@ import (
 	"tg-bot-go/models"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -20,12 +19,17 @@ var (
 )
 
 type Configuration struct {
-	Database DatabaseConfig
-	Telegram TelegramConfig
-	OpenAI   OpenAIConfig
-	Redis    RedisConfig
-	Presets  PresetConfig
-	Admin    AdminConfig
+	Database   DatabaseConfig
+	Telegram   TelegramConfig
+	LLM        LLMConfig
+	OpenAI     OpenAIConfig
+	Anthropic  AnthropicConfig
+	Gemini     GeminiConfig
+	Ollama     OllamaConfig
+	Transcribe TranscribeConfig
+	Context    ContextConfig
+	Redis      RedisConfig
+	Admin      AdminConfig
 }
 
 type DatabaseConfig struct {
@@ -38,25 +42,84 @@ type DatabaseConfig struct {
 }
 
 type TelegramConfig struct {
-	BotToken string
+	BotToken      string
+	WebhookURL    string // Webhook 模式下注册给 Telegram 的公网地址
+	WebhookListen string // Webhook HTTP 服务监听地址
+	WebhookSecret string // 校验 X-Telegram-Bot-Api-Secret-Token 请求头
 }
 
 type OpenAIConfig struct {
-    APIURL string
-    APIKey string
-    Model  string
-    HTTPReferer string
-    XTitle      string
+	APIURL      string
+	APIKey      string
+	Model       string
+	HTTPReferer string
+	XTitle      string
+}
+
+// LLMConfig 选择默认使用的大模型后端 (openai / anthropic / gemini / ollama)
+type LLMConfig struct {
+	Provider         string
+	Fallback         []string // 故障转移链，格式为 provider[:model]，设置后作为默认后端
+	MaxRetries       int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type AnthropicConfig struct {
+	APIURL string
+	APIKey string
+	Model  string
+}
+
+type GeminiConfig struct {
+	APIURL string
+	APIKey string
+	Model  string
+}
+
+type OllamaConfig struct {
+	APIURL string
+	Model  string
+	Vision bool
+}
+
+// TranscribeConfig OpenAI 兼容的语音转写接口
+type TranscribeConfig struct {
+	Enabled bool // 设置了 TRANSCRIBE_API_URL 或 API Key 时启用，本地服务可以不需要 API Key
+	APIURL  string
+	APIKey  string
+	Model   string
+}
+
+// ContextConfig 对话上下文的 token 预算
+type ContextConfig struct {
+	TokenizerDir  string         // tiktoken 格式的分词表目录，缺少对应文件时按字符估算
+	MaxTokens     int            // 上下文 (提示词 + 历史 + 本条消息) 的 token 上限，0 表示只受模型窗口限制
+	ReserveTokens int            // 为回复预留的 token 数，预设设置了 max_tokens 时以预设为准
+	ModelWindows  map[string]int // 覆盖内置的模型上下文窗口，按模型名前缀匹配
 }
 
 type RedisConfig struct {
-	Addr string
+	Addr      string
+	KeyPrefix string // 键前缀，多个实例共享同一个 Redis 数据库时用于隔离
 }
 
 type PresetItem struct {
-	Button  string
-	Command string
-	Content string
+	Button   string
+	Command  string
+	Content  string
+	Provider string // 可选，指定该预设使用的后端，为空时使用 LLM_PROVIDER
+	Model    string // 可选，指定该预设使用的模型，为空时使用后端的默认模型
+
+	// 可选，自动互译的语言对，例如 ["zh", "ja"]：检测到第一种语言时译为第二种，其他语言一律译为第一种
+	Pair []string `toml:"pair"`
+
+	// 以下生成参数均为可选，未设置时使用后端的默认值
+	Temperature    *float64 `toml:"temperature"`
+	TopP           *float64 `toml:"top_p"`
+	MaxTokens      int      `toml:"max_tokens"`
+	Stop           []string `toml:"stop"`
+	ResponseFormat string   `toml:"response_format"` // text 或 json
 }
 
 type PresetConfig struct {
@@ -79,17 +142,12 @@ func InitConfig() {
 		}
 	}
 
-	// 从 TOML 文件读取预设配置
-	var presets PresetConfig
-	if _, err := toml.DecodeFile("config/presets.toml", &presets); err != nil {
+	// 从 TOML 文件读取预设配置，运行中修改文件会被热加载 (见 WatchPresets)
+	if err := LoadPresetFile(PresetsFile); err != nil {
 		log.Printf("Warning: Could not load presets.toml: %v", err)
-		// 使用默认预设
-		presets = PresetConfig{
-			Items: []PresetItem{},
-		}
 	}
 
-    Config = Configuration{
+	Config = Configuration{
 		Database: DatabaseConfig{
 			Host:     getEnvOrDefault("DB_HOST", "localhost"),
 			User:     getEnvOrDefault("DB_USER", "root"),
@@ -99,22 +157,59 @@ func InitConfig() {
 			SSLMode:  getEnvOrDefault("DB_SSLMODE", "disable"),
 		},
 		Telegram: TelegramConfig{
-			BotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
+			BotToken:      os.Getenv("TELEGRAM_BOT_TOKEN"),
+			WebhookURL:    os.Getenv("TELEGRAM_WEBHOOK_URL"),
+			WebhookListen: getEnvOrDefault("TELEGRAM_WEBHOOK_LISTEN", ":8080"),
+			WebhookSecret: os.Getenv("TELEGRAM_WEBHOOK_SECRET"),
+		},
+		OpenAI: OpenAIConfig{
+			APIURL:      getEnvOrDefault("OPENROUTER_API_URL", getEnvOrDefault("OPENAI_API_URL", "https://openrouter.ai/api")),
+			APIKey:      getEnvOrDefault("OPENROUTER_API_KEY", os.Getenv("OPENAI_API_KEY")),
+			Model:       getEnvOrDefault("OPENROUTER_MODEL", getEnvOrDefault("OPENAI_MODEL", "openai/gpt-4o")),
+			HTTPReferer: os.Getenv("OPENROUTER_HTTP_REFERER"),
+			XTitle:      os.Getenv("OPENROUTER_X_TITLE"),
+		},
+		LLM: LLMConfig{
+			Provider:         getEnvOrDefault("LLM_PROVIDER", "openai"),
+			Fallback:         splitList(os.Getenv("LLM_FALLBACK")),
+			MaxRetries:       int(getEnvAsInt64("LLM_MAX_RETRIES", 2)),
+			BreakerThreshold: int(getEnvAsInt64("LLM_BREAKER_THRESHOLD", 3)),
+			BreakerCooldown:  time.Duration(getEnvAsInt64("LLM_BREAKER_COOLDOWN", 60)) * time.Second,
+		},
+		Anthropic: AnthropicConfig{
+			APIURL: getEnvOrDefault("ANTHROPIC_API_URL", "https://api.anthropic.com"),
+			APIKey: os.Getenv("ANTHROPIC_API_KEY"),
+			Model:  getEnvOrDefault("ANTHROPIC_MODEL", "claude-3-5-sonnet-latest"),
+		},
+		Gemini: GeminiConfig{
+			APIURL: getEnvOrDefault("GEMINI_API_URL", "https://generativelanguage.googleapis.com"),
+			APIKey: os.Getenv("GEMINI_API_KEY"),
+			Model:  getEnvOrDefault("GEMINI_MODEL", "gemini-1.5-flash"),
+		},
+		Ollama: OllamaConfig{
+			APIURL: getEnvOrDefault("OLLAMA_API_URL", "http://localhost:11434"),
+			Model:  os.Getenv("OLLAMA_MODEL"),
+			Vision: getEnvAsBool("OLLAMA_VISION", false),
+		},
+		Transcribe: TranscribeConfig{
+			Enabled: os.Getenv("TRANSCRIBE_API_URL") != "" || getEnvOrDefault("TRANSCRIBE_API_KEY", os.Getenv("OPENAI_API_KEY")) != "",
+			APIURL:  getEnvOrDefault("TRANSCRIBE_API_URL", getEnvOrDefault("OPENAI_API_URL", "https://api.openai.com")),
+			APIKey:  getEnvOrDefault("TRANSCRIBE_API_KEY", os.Getenv("OPENAI_API_KEY")),
+			Model:   getEnvOrDefault("TRANSCRIBE_MODEL", "whisper-1"),
+		},
+		Context: ContextConfig{
+			TokenizerDir:  getEnvOrDefault("TOKENIZER_DIR", "config/tokenizers"),
+			MaxTokens:     int(getEnvAsInt64("CONTEXT_MAX_TOKENS", 8000)),
+			ReserveTokens: int(getEnvAsInt64("CONTEXT_RESERVE_TOKENS", 1024)),
+			ModelWindows:  parseModelWindows(os.Getenv("MODEL_CONTEXT_WINDOWS")),
 		},
-        OpenAI: OpenAIConfig{
-            APIURL: getEnvOrDefault("OPENROUTER_API_URL", getEnvOrDefault("OPENAI_API_URL", "https://openrouter.ai/api")),
-            APIKey: getEnvOrDefault("OPENROUTER_API_KEY", os.Getenv("OPENAI_API_KEY")),
-            Model:  getEnvOrDefault("OPENROUTER_MODEL", getEnvOrDefault("OPENAI_MODEL", "openai/gpt-4o")),
-            HTTPReferer: os.Getenv("OPENROUTER_HTTP_REFERER"),
-            XTitle:      os.Getenv("OPENROUTER_X_TITLE"),
-        },
 		Redis: RedisConfig{
 			Addr: fmt.Sprintf("%s:%s",
 				getEnvOrDefault("REDIS_HOST", "localhost"),
 				getEnvOrDefault("REDIS_PORT", "6379"),
 			),
+			KeyPrefix: getEnvOrDefault("REDIS_KEY_PREFIX", "tgbot"),
 		},
-		Presets: presets,
 		Admin: AdminConfig{
 			AdminUserIDs: adminUserIDs,
 		},
@@ -158,6 +253,41 @@ func getEnvAsInt64(key string, defaultVal int64) int64 {
 	return defaultVal
 }
 
+// splitList 解析逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseModelWindows 解析 model=tokens 形式的逗号分隔列表，例如 qwen2.5=32768,my-model=4096
+func parseModelWindows(value string) map[string]int {
+	windows := make(map[string]int)
+	for _, item := range splitList(value) {
+		model, tokens, found := strings.Cut(item, "=")
+		size, err := strconv.Atoi(strings.TrimSpace(tokens))
+		if !found || err != nil || size <= 0 {
+			log.Printf("Warning: Invalid MODEL_CONTEXT_WINDOWS entry %q", item)
+			continue
+		}
+		windows[strings.ToLower(strings.TrimSpace(model))] = size
+	}
+	return windows
+}
+
+func getEnvAsBool(key string, defaultVal bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultVal
+}
+
 func InitDB() {
 	dbConfig := Config.Database
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
@@ -165,7 +295,7 @@ func InitDB() {
 
 	var db *gorm.DB
 	var err error
-	
+
 	// 增加重试机制 (最多重试 5 次，每次间隔 5 秒)
 	for i := 0; i < 5; i++ {
 		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"tg-bot-go/models"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gorm.io/gorm"
+)
+
+const (
+	PresetsFile           = "config/presets.toml"
+	PresetsReloadInterval = 10 * time.Second // 检查预设文件修改与数据库变更的间隔
+)
+
+// PresetEntry 合并后的预设及其来源，供管理员查看
+type PresetEntry struct {
+	PresetItem
+	Position int
+	Disabled bool
+	Source   string // file / db / file+db
+}
+
+// 预设由 presets.toml 与数据库中的 GlobalPreset 合并而来，合并结果整体原子替换，
+// 处理中的请求持有的是替换前的快照，不会读到一半更新的数据
+var (
+	presetsMu      sync.Mutex // 串行化重新合并
+	filePresets    []PresetItem
+	dbPresets      []models.GlobalPreset
+	presetFileTime time.Time
+
+	presetEntries atomic.Pointer[[]PresetEntry]
+	activePresets atomic.Pointer[[]PresetItem]
+)
+
+// Presets 返回当前启用的全局预设，返回的切片不可修改
+func Presets() []PresetItem {
+	if p := activePresets.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// PresetEntries 返回包括已禁用在内的全部全局预设，按顺序排列
+func PresetEntries() []PresetEntry {
+	if p := presetEntries.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// FindPreset 根据命令查找启用的预设
+func FindPreset(command string) (PresetItem, bool) {
+	for _, item := range Presets() {
+		if item.Command == command {
+			return item, true
+		}
+	}
+	return PresetItem{}, false
+}
+
+// LoadPresetFile 读取预设文件并重新合并
+func LoadPresetFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var file PresetConfig
+	if _, err := toml.DecodeFile(path, &file); err != nil {
+		return err
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	filePresets = file.Items
+	presetFileTime = info.ModTime()
+	rebuildPresets()
+	return nil
+}
+
+// ReloadDBPresets 读取数据库中的全局预设并重新合并
+func ReloadDBPresets(db *gorm.DB) error {
+	rows, err := models.ListGlobalPresets(db)
+	if err != nil {
+		return err
+	}
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	dbPresets = rows
+	rebuildPresets()
+	return nil
+}
+
+// WatchPresets 定期检查预设文件的修改时间与数据库中的全局预设，变化时热加载，直到 ctx 结束。
+// 数据库也需要轮询，以便多实例部署时同步其他实例上管理员的修改
+func WatchPresets(ctx context.Context, path string, db *gorm.DB) {
+	ticker := time.NewTicker(PresetsReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if info, err := os.Stat(path); err == nil {
+			presetsMu.Lock()
+			changed := !info.ModTime().Equal(presetFileTime)
+			presetsMu.Unlock()
+			if changed {
+				// 解析失败时保留旧的预设，避免编辑到一半的文件清空所有预设
+				if err := LoadPresetFile(path); err != nil {
+					log.Printf("Warning: Could not reload %s: %v", path, err)
+				} else {
+					log.Printf("Reloaded presets from %s", path)
+				}
+			}
+		}
+
+		if err := ReloadDBPresets(db.WithContext(ctx)); err != nil && ctx.Err() == nil {
+			log.Printf("Warning: Could not reload presets from database: %v", err)
+		}
+	}
+}
+
+// rebuildPresets 合并文件与数据库中的预设，调用方需持有 presetsMu
+func rebuildPresets() {
+	var entries []PresetEntry
+	index := make(map[string]int)
+	for i, item := range filePresets {
+		index[item.Command] = len(entries)
+		entries = append(entries, PresetEntry{PresetItem: item, Position: (i + 1) * 10, Source: "file"})
+	}
+
+	// 数据库中新增的预设默认排在文件预设之后
+	next := (len(filePresets) + 1) * 10
+	for _, row := range dbPresets {
+		i, ok := index[row.Command]
+		if ok {
+			entries[i].Source = "file+db"
+		} else {
+			// 调整排序等操作会为文件预设写入只有覆盖字段的行，文件中删除该预设后这些行没有按钮或内容，忽略
+			if row.Button == nil || *row.Button == "" || row.Content == nil || *row.Content == "" {
+				continue
+			}
+			i = len(entries)
+			index[row.Command] = i
+			entries = append(entries, PresetEntry{PresetItem: PresetItem{Command: row.Command}, Position: next + int(row.ID), Source: "db"})
+		}
+		e := &entries[i]
+		if row.Button != nil {
+			e.Button = *row.Button
+		}
+		if row.Content != nil {
+			e.Content = *row.Content
+		}
+		if row.Provider != nil {
+			e.Provider = *row.Provider
+		}
+		if row.Position != nil {
+			e.Position = *row.Position
+		}
+		if row.Model != nil {
+			e.Model = *row.Model
+		}
+		if row.Temperature != nil {
+			e.Temperature = row.Temperature
+		}
+		if row.TopP != nil {
+			e.TopP = row.TopP
+		}
+		if row.MaxTokens != nil {
+			e.MaxTokens = *row.MaxTokens
+		}
+		if row.Stop != nil {
+			e.Stop = row.Stop
+		}
+		if row.ResponseFormat != nil {
+			e.ResponseFormat = *row.ResponseFormat
+		}
+		if row.Pair != nil {
+			e.Pair = row.Pair
+		}
+		e.Disabled = row.Disabled
+	}
+
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].Position < entries[b].Position })
+
+	var active []PresetItem
+	for _, e := range entries {
+		if !e.Disabled {
+			active = append(active, e.PresetItem)
+		}
+	}
+	presetEntries.Store(&entries)
+	activePresets.Store(&active)
+}
+
+// String 管理员查看时的简要说明
+func (e PresetEntry) String() string {
+	state := ""
+	if e.Disabled {
+		state = "，已禁用"
+	}
+	return fmt.Sprintf("%s %s（%s%s）", e.Command, e.Button, e.Source, state)
+}
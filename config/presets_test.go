@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+	"tg-bot-go/models"
+)
+
+func TestRebuildPresetsSkipsOrphanOverrides(t *testing.T) {
+	button, content := "新预设", "提示词"
+	position := 10
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	filePresets = []PresetItem{{Command: "/kept", Button: "保留", Content: "a"}}
+	dbPresets = []models.GlobalPreset{
+		// 调整排序时为文件预设写入的行，其中 /removed 已从文件中删除
+		{ID: 1, Command: "/kept", Position: &position},
+		{ID: 2, Command: "/removed", Position: &position},
+		{ID: 3, Command: "/added", Button: &button, Content: &content},
+	}
+	rebuildPresets()
+
+	var commands []string
+	for _, item := range Presets() {
+		if item.Button == "" {
+			t.Fatalf("preset %s has an empty button", item.Command)
+		}
+		commands = append(commands, item.Command)
+	}
+	if len(commands) != 2 || commands[0] != "/kept" || commands[1] != "/added" {
+		t.Fatalf("unexpected presets %v", commands)
+	}
+}
@@ -0,0 +1,131 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"tg-bot-go/logger"
+	"time"
+)
+
+// Dispatcher 按 key 串行执行任务：同一个 key 的任务按提交顺序依次执行，
+// 不同 key 之间并行，整体并发数受 maxConcurrent 限制
+type Dispatcher struct {
+	sem       chan struct{}
+	queueSize int
+
+	mu      sync.Mutex
+	queues  map[string]*keyQueue
+	pending map[string]*pendingJob
+	wg      sync.WaitGroup
+}
+
+// pendingJob 防抖等待中的任务，由 Dispatcher.mu 保护
+type pendingJob struct {
+	timer *time.Timer
+	job   func()
+}
+
+// keyQueue 某个 key 等待执行的任务，由 Dispatcher.mu 保护
+type keyQueue struct {
+	jobs []func()
+}
+
+// New 创建 Dispatcher，queueSize 为每个 key 最多排队等待的任务数 (不含正在执行的任务)
+func New(maxConcurrent, queueSize int) *Dispatcher {
+	return &Dispatcher{
+		sem:       make(chan struct{}, maxConcurrent),
+		queueSize: queueSize,
+		queues:    make(map[string]*keyQueue),
+		pending:   make(map[string]*pendingJob),
+	}
+}
+
+// Submit 提交任务，该 key 排队的任务已满时返回 false
+func (d *Dispatcher) Submit(key string, job func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if q, ok := d.queues[key]; ok {
+		if len(q.jobs) >= d.queueSize {
+			return false
+		}
+		q.jobs = append(q.jobs, job)
+		return true
+	}
+
+	// 该 key 没有正在运行的 worker，启动一个
+	q := &keyQueue{jobs: []func(){job}}
+	d.queues[key] = q
+	d.wg.Add(1)
+	go d.run(key, q)
+	return true
+}
+
+// Debounce 在 delay 之后提交任务；等待期间同一个 key 再次调用时只保留最新的任务并重新计时。
+// 等待期间不占用并发名额，Wait 会等待尚未提交的任务
+func (d *Dispatcher) Debounce(key string, delay time.Duration, job func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if p, ok := d.pending[key]; ok {
+		p.job = job
+		p.timer.Reset(delay)
+		return
+	}
+	p := &pendingJob{job: job}
+	d.pending[key] = p
+	d.wg.Add(1)
+	p.timer = time.AfterFunc(delay, func() { d.fire(key, p) })
+}
+
+// fire 防抖到期后提交任务；计时器被重置时可能触发多次，只有第一次生效
+func (d *Dispatcher) fire(key string, p *pendingJob) {
+	d.mu.Lock()
+	if d.pending[key] != p {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	job := p.job
+	d.mu.Unlock()
+
+	if !d.Submit(key, job) {
+		logger.LogRuntime(fmt.Sprintf("Dropped debounced job for %s: queue full", key))
+	}
+	d.wg.Done()
+}
+
+// Wait 等待所有已提交的任务执行完毕
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// run 依次执行某个 key 的任务，队列清空后退出
+func (d *Dispatcher) run(key string, q *keyQueue) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		if len(q.jobs) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		job := q.jobs[0]
+		q.jobs = q.jobs[1:]
+		d.mu.Unlock()
+
+		d.sem <- struct{}{} // 获取信号量
+		d.execute(job)
+		<-d.sem // 释放信号量
+	}
+}
+
+// execute 使用 recover 来防止任务崩溃影响同一 key 后续的任务
+func (d *Dispatcher) execute(job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.LogRuntime(fmt.Sprintf("Recovered from panic in message handler: %v", r))
+		}
+	}()
+	job()
+}
@@ -0,0 +1,141 @@
+package dispatcher
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubmitRunsSameKeyInOrder(t *testing.T) {
+	d := New(4, 100)
+
+	var mu sync.Mutex
+	var order []int
+	var running int32
+	for i := 0; i < 20; i++ {
+		i := i
+		if !d.Submit("k", func() {
+			if atomic.AddInt32(&running, 1) > 1 {
+				t.Error("two jobs of the same key ran concurrently")
+			}
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			atomic.AddInt32(&running, -1)
+		}) {
+			t.Fatalf("job %d rejected", i)
+		}
+	}
+	d.Wait()
+
+	if len(order) != 20 {
+		t.Fatalf("expected 20 jobs, ran %d", len(order))
+	}
+	for i, v := range order {
+		if v != i {
+			t.Fatalf("jobs ran out of order: %v", order)
+		}
+	}
+}
+
+func TestSubmitRejectsWhenQueueFull(t *testing.T) {
+	d := New(1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	// 第一个任务运行中，之后最多排队 2 个
+	d.Submit("k", func() { close(started); <-release })
+	<-started
+	if !d.Submit("k", func() {}) || !d.Submit("k", func() {}) {
+		t.Fatal("jobs within the queue size should be accepted")
+	}
+	if d.Submit("k", func() {}) {
+		t.Fatal("job beyond the queue size should be rejected")
+	}
+	// 其他 key 不受影响
+	if !d.Submit("other", func() {}) {
+		t.Fatal("a full queue should not block other keys")
+	}
+
+	close(release)
+	d.Wait()
+
+	// 队列清空后重新接受任务
+	if !d.Submit("k", func() {}) {
+		t.Fatal("drained queue should accept jobs again")
+	}
+	d.Wait()
+}
+
+func TestSubmitLimitsConcurrency(t *testing.T) {
+	d := New(2, 10)
+
+	var running, peak int32
+	for i := 0; i < 10; i++ {
+		d.Submit(string(rune('a'+i)), func() {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+		})
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Fatalf("expected at most 2 concurrent jobs, got %d", peak)
+	}
+}
+
+func TestPanicDoesNotStopQueue(t *testing.T) {
+	d := New(1, 10)
+	var ran bool
+	d.Submit("k", func() { panic("boom") })
+	d.Submit("k", func() { ran = true })
+	d.Wait()
+
+	if !ran {
+		t.Fatal("job after a panicking job should still run")
+	}
+}
+
+func TestDebounceRunsOnlyLatestJob(t *testing.T) {
+	d := New(1, 10)
+
+	var mu sync.Mutex
+	var ran []int
+	for i := 0; i < 5; i++ {
+		i := i
+		d.Debounce("k", 20*time.Millisecond, func() {
+			mu.Lock()
+			ran = append(ran, i)
+			mu.Unlock()
+		})
+		time.Sleep(2 * time.Millisecond)
+	}
+	// Wait 需要等待尚未到期的任务
+	d.Wait()
+
+	if len(ran) != 1 || ran[0] != 4 {
+		t.Fatalf("expected only the latest job to run, got %v", ran)
+	}
+}
+
+func TestDebounceKeysAreIndependent(t *testing.T) {
+	d := New(2, 10)
+
+	var count int32
+	d.Debounce("a", 5*time.Millisecond, func() { atomic.AddInt32(&count, 1) })
+	d.Debounce("b", 5*time.Millisecond, func() { atomic.AddInt32(&count, 1) })
+	d.Wait()
+
+	if count != 2 {
+		t.Fatalf("expected both keys to run, got %d", count)
+	}
+}
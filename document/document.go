@@ -0,0 +1,120 @@
+package document
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Format 支持翻译的文档格式
+type Format string
+
+const (
+	FormatText     Format = "txt"
+	FormatMarkdown Format = "md"
+	FormatSRT      Format = "srt"
+	FormatVTT      Format = "vtt"
+	FormatDocx     Format = "docx"
+)
+
+// DetectFormat 根据文件名判断文档格式，不支持时返回 false
+func DetectFormat(filename string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".txt":
+		return FormatText, true
+	case ".md", ".markdown":
+		return FormatMarkdown, true
+	case ".srt":
+		return FormatSRT, true
+	case ".vtt":
+		return FormatVTT, true
+	case ".docx":
+		return FormatDocx, true
+	}
+	return "", false
+}
+
+// IsSubtitle 判断是否为需要保留时间轴的字幕格式
+func (f Format) IsSubtitle() bool {
+	return f == FormatSRT || f == FormatVTT
+}
+
+// SplitParagraphs 按空行拆分段落，统一换行符并丢弃空段落
+func SplitParagraphs(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var paragraphs []string
+	for _, p := range strings.Split(text, "\n\n") {
+		if strings.TrimSpace(p) != "" {
+			paragraphs = append(paragraphs, strings.Trim(p, "\n"))
+		}
+	}
+	return paragraphs
+}
+
+// Chunk 将段落按顺序合并为不超过 maxRunes 个字符的分块，尽量不在段落中间切断；
+// 单个段落超长时再按行、最后按字符切分
+func Chunk(paragraphs []string, maxRunes int) [][]string {
+	var pieces []string
+	for _, p := range paragraphs {
+		pieces = append(pieces, splitLong(p, maxRunes)...)
+	}
+	return Group(pieces, maxRunes)
+}
+
+// Group 将段落按顺序合并为不超过 maxRunes 个字符的分块，从不切分段落，超长段落单独成块
+func Group(paragraphs []string, maxRunes int) [][]string {
+	var chunks [][]string
+	var current []string
+	currentLen := 0
+
+	for _, p := range paragraphs {
+		n := len([]rune(p))
+		if currentLen > 0 && currentLen+n > maxRunes {
+			chunks = append(chunks, current)
+			current, currentLen = nil, 0
+		}
+		current = append(current, p)
+		currentLen += n
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// splitLong 将超过 maxRunes 的段落按行切分，单行仍超长时按字符切分
+func splitLong(paragraph string, maxRunes int) []string {
+	if len([]rune(paragraph)) <= maxRunes {
+		return []string{paragraph}
+	}
+
+	var pieces []string
+	var current strings.Builder
+	currentLen := 0
+	for _, line := range strings.Split(paragraph, "\n") {
+		runes := []rune(line)
+		for len(runes) > maxRunes {
+			if current.Len() > 0 {
+				pieces = append(pieces, current.String())
+				current.Reset()
+				currentLen = 0
+			}
+			pieces = append(pieces, string(runes[:maxRunes]))
+			runes = runes[maxRunes:]
+		}
+		if currentLen > 0 && currentLen+len(runes)+1 > maxRunes {
+			pieces = append(pieces, current.String())
+			current.Reset()
+			currentLen = 0
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+			currentLen++
+		}
+		current.WriteString(string(runes))
+		currentLen += len(runes)
+	}
+	if current.Len() > 0 {
+		pieces = append(pieces, current.String())
+	}
+	return pieces
+}
@@ -0,0 +1,148 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const docxBodyPath = "word/document.xml"
+
+var (
+	docxParagraphRe = regexp.MustCompile(`(?s)<w:p(?:\s[^>]*[^/>])?>.*?</w:p>`)
+	docxTextRe      = regexp.MustCompile(`(?s)<w:t(?:\s[^>]*[^/>])?>(.*?)</w:t>`)
+)
+
+// Docx 解析后的 Word 文档，只处理正文段落中的文字，样式与其他部件原样保留
+type Docx struct {
+	files      []*zip.File
+	body       string
+	Paragraphs []string // 非空段落的纯文本，顺序与文档一致
+}
+
+// ReadDocx 解析 .docx 文件
+func ReadDocx(data []byte) (*Docx, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Docx{files: reader.File}
+	for _, f := range reader.File {
+		if f.Name != docxBodyPath {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		doc.body = string(body)
+	}
+	if doc.body == "" {
+		return nil, fmt.Errorf("docx: %s not found", docxBodyPath)
+	}
+
+	for _, p := range docxParagraphRe.FindAllString(doc.body, -1) {
+		if text := paragraphText(p); strings.TrimSpace(text) != "" {
+			doc.Paragraphs = append(doc.Paragraphs, text)
+		}
+	}
+	return doc, nil
+}
+
+// Write 用译文替换各段落文字并重新打包，translated 与 Paragraphs 一一对应；
+// 译文写入段落的第一个文字块，其余文字块清空，因此段内混排的样式会合并为第一段的样式
+func (d *Docx) Write(translated []string) ([]byte, error) {
+	if len(translated) != len(d.Paragraphs) {
+		return nil, fmt.Errorf("docx: expected %d paragraphs, got %d", len(d.Paragraphs), len(translated))
+	}
+
+	i := 0
+	body := docxParagraphRe.ReplaceAllStringFunc(d.body, func(p string) string {
+		if strings.TrimSpace(paragraphText(p)) == "" {
+			return p
+		}
+		text := translated[i]
+		i++
+
+		first := true
+		return docxTextRe.ReplaceAllStringFunc(p, func(string) string {
+			if !first {
+				return "<w:t></w:t>"
+			}
+			first = false
+			return `<w:t xml:space="preserve">` + escapeXML(text) + "</w:t>"
+		})
+	})
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, f := range d.files {
+		w, err := writer.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   f.Method,
+			Modified: f.Modified,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if f.Name == docxBodyPath {
+			if _, err := io.WriteString(w, body); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func paragraphText(p string) string {
+	var text strings.Builder
+	for _, m := range docxTextRe.FindAllStringSubmatch(p, -1) {
+		text.WriteString(html.UnescapeString(m[1]))
+	}
+	return text.String()
+}
+
+func escapeXML(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\n':
+			// 段内换行用空格代替，避免生成非法的文字块
+			buf.WriteString(" ")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+package document
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var paragraphMarkerRe = regexp.MustCompile(`^\[\[(\d+)\]\]$`)
+
+// ParagraphInstruction 追加到翻译预设之后的带编号段落格式说明
+const ParagraphInstruction = "\n\n输入是文档的若干段落，每段以单独一行的 [[编号]] 开头，后面是段落文本。" +
+	"请逐段翻译，保留每段的 [[编号]] 行及其顺序，不要合并、拆分或省略任何一段，只输出译文，不要添加任何解释。"
+
+// EncodeParagraphs 将一组段落编码为带编号的文本，编号从 1 开始
+func EncodeParagraphs(paragraphs []string) string {
+	var out strings.Builder
+	for i, p := range paragraphs {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "[[%d]]\n%s", i+1, p)
+	}
+	return out.String()
+}
+
+// DecodeParagraphs 按编号将译文回填到对应的段落；模型遗漏的段落保留原文，
+// 返回与 source 等长的段落及遗漏的段落数
+func DecodeParagraphs(text string, source []string) ([]string, int) {
+	lines := make([][]string, len(source))
+	seen := make([]bool, len(source))
+	current := -1
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := paragraphMarkerRe.FindStringSubmatch(trimmed); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			if n >= 1 && n <= len(source) {
+				current = n - 1
+				seen[current] = true
+			} else {
+				current = -1
+			}
+			continue
+		}
+		if current < 0 || trimmed == "" {
+			continue
+		}
+		lines[current] = append(lines[current], trimmed)
+	}
+
+	paragraphs := make([]string, len(source))
+	missing := 0
+	for i := range source {
+		if !seen[i] || len(lines[i]) == 0 {
+			paragraphs[i] = source[i]
+			missing++
+			continue
+		}
+		paragraphs[i] = strings.Join(lines[i], "\n")
+	}
+	return paragraphs, missing
+}
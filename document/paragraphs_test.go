@@ -0,0 +1,40 @@
+package document
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncodeParagraphs(t *testing.T) {
+	got := EncodeParagraphs([]string{"第一段", "第二段"})
+	want := "[[1]]\n第一段\n[[2]]\n第二段"
+	if got != want {
+		t.Fatalf("EncodeParagraphs = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeParagraphs(t *testing.T) {
+	source := []string{"一", "二", "三"}
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		missing int
+	}{
+		{"in order", "[[1]]\none\n[[2]]\ntwo\n[[3]]\nthree", []string{"one", "two", "three"}, 0},
+		{"reordered", "[[2]]\ntwo\n[[1]]\none\n[[3]]\nthree", []string{"one", "two", "three"}, 0},
+		{"multi-line paragraph", "[[1]]\none\nmore\n\n[[2]]\ntwo\n[[3]]\nthree", []string{"one\nmore", "two", "three"}, 0},
+		{"missing marker keeps source", "[[1]]\none\n[[3]]\nthree", []string{"one", "二", "three"}, 1},
+		{"merged paragraphs", "[[1]]\none two three", []string{"one two three", "二", "三"}, 2},
+		{"text before first marker ignored", "Here you go:\n[[1]]\none\n[[2]]\ntwo\n[[3]]\nthree", []string{"one", "two", "three"}, 0},
+		{"out of range marker ignored", "[[1]]\none\n[[9]]\nnine\n[[2]]\ntwo\n[[3]]\nthree", []string{"one", "two", "three"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing := DecodeParagraphs(tt.text, source)
+			if !reflect.DeepEqual(got, tt.want) || missing != tt.missing {
+				t.Fatalf("DecodeParagraphs = %q (missing %d), want %q (missing %d)", got, missing, tt.want, tt.missing)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,13 +12,14 @@ import (
 )
 
 // handleAdminCommand 管理员命令处理函数
-func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
+func (h *Handler) handleAdminCommand(ctx context.Context, update tgbotapi.Update) {
 	chatID := update.Message.Chat.ID
 	text := update.Message.Text
+	db := h.DB.WithContext(ctx)
 
 	// 检查发送者是否是管理员
 	var admin models.WhitelistUser
-	if err := h.DB.Where("user_id = ? AND is_admin = ?", chatID, true).First(&admin).Error; err != nil {
+	if err := db.Where("user_id = ? AND is_admin = ?", update.Message.From.ID, true).First(&admin).Error; err != nil {
 		msg := tgbotapi.NewMessage(chatID, "您没有管理员权限。")
 		h.Bot.Send(msg)
 		return
@@ -25,12 +27,12 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 
 	// 解析命令
 	parts := strings.Fields(text)
-	command := parts[0]
+	command, _ := h.parseCommand(text)
 
 	// 处理不需要参数的命令
 	if command == "/checkuser" && len(parts) == 1 {
 		var users []models.WhitelistUser
-		if err := h.DB.Find(&users).Error; err != nil {
+		if err := db.Find(&users).Error; err != nil {
 			msg := tgbotapi.NewMessage(chatID, "获取用户列表失败。")
 			h.Bot.Send(msg)
 			return
@@ -74,7 +76,7 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 
 	switch command {
 	case "/checkuser":
-		user, err := models.GetUserExpiry(h.DB, userID)
+		user, err := models.GetUserExpiry(db, userID)
 		if err != nil {
 			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("用户 %d 不存在。", userID))
 			h.Bot.Send(msg)
@@ -106,7 +108,7 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 			}
 		}
 
-		if err := models.AddUserToWhitelist(h.DB, userID, false); err != nil {
+		if err := models.AddUserToWhitelist(db, userID, false); err != nil {
 			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("添加用户失败：%v", err))
 			h.Bot.Send(msg)
 			return
@@ -115,7 +117,7 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 		h.Bot.Send(msg)
 
 	case "/deleteuser":
-		if err := models.DeleteUserFromWhitelist(h.DB, userID); err != nil {
+		if err := models.DeleteUserFromWhitelist(db, userID); err != nil {
 			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("删除用户失败：%v", err))
 			h.Bot.Send(msg)
 			return
@@ -138,7 +140,7 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 		}
 
 		duration := time.Duration(days) * 24 * time.Hour
-		if err := models.ExtendUserExpiry(h.DB, userID, duration); err != nil {
+		if err := models.ExtendUserExpiry(db, userID, duration); err != nil {
 			msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("延长用户有效期失败：%v", err))
 			h.Bot.Send(msg)
 			return
@@ -149,30 +151,26 @@ func (h *Handler) handleAdminCommand(update tgbotapi.Update) {
 }
 
 // handleExpiryCommand 处理有效期查询
-func (h *Handler) handleExpiryCommand(update tgbotapi.Update) {
-	chatID := update.Message.Chat.ID
-
-	user, err := models.GetUserExpiry(h.DB, chatID)
+func (h *Handler) handleExpiryCommand(ctx context.Context, s session) {
+	user, err := models.GetUserExpiry(h.DB.WithContext(ctx), s.UserID)
 	if err != nil {
-		msg := tgbotapi.NewMessage(chatID, "您还不是白名单用户。")
-		h.Bot.Send(msg)
+		h.Bot.Send(s.reply("您还不是白名单用户。"))
 		return
 	}
 
 	var messageText string
 	if user.IsAdmin {
-		messageText = "您是管理员用户，永久有效。"
+		messageText = s.tr("您是管理员用户，永久有效。")
 	} else {
 		remainingTime := user.ExpiredAt.Sub(time.Now())
 		if remainingTime <= 0 {
-			messageText = "您的使用权限已过期。"
+			messageText = s.tr("您的使用权限已过期。")
 		} else {
 			days := int(remainingTime.Hours() / 24)
 			hours := int(remainingTime.Hours()) % 24
-			messageText = fmt.Sprintf("您的使用权限还剩 %d 天 %d 小时。", days, hours)
+			messageText = s.trf("您的使用权限还剩 %d 天 %d 小时。", days, hours)
 		}
 	}
 
-	msg := tgbotapi.NewMessage(chatID, messageText)
-	h.Bot.Send(msg)
-}
\ No newline at end of file
+	h.Bot.Send(s.reply(messageText))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/langdetect"
+	"tg-bot-go/models"
+)
+
+const (
+	AUTO_PAIR_PROMPT  = "你是一个翻译引擎，忠实于原文意思翻译用户发送的内容，译文符合目标语言的自然表达，只输出译文，不添加任何解释。"
+	AUTO_SAMPLE_RUNES = 2000 // 检测语言时最多读取的字符数
+)
+
+// autoPair 返回预设的自动互译语言对，未配置或配置有误时 ok 为 false
+func autoPair(preset config.PresetItem) (home, partner string, ok bool) {
+	if len(preset.Pair) != 2 || preset.Pair[0] == "" || preset.Pair[1] == "" || preset.Pair[0] == preset.Pair[1] {
+		return "", "", false
+	}
+	return preset.Pair[0], preset.Pair[1], true
+}
+
+// pairTarget 检测到第一种语言时译为第二种，其他语言一律译为第一种
+func pairTarget(home, partner, source string) string {
+	if source == home {
+		return partner
+	}
+	return home
+}
+
+// translationLanguages 返回输入文本的语言与译文目标语言的代码，无法确定时为空
+func translationLanguages(preset config.PresetItem, settings models.UserSettings, text string) (source, target string) {
+	source = langdetect.Detect(truncateRunes(text, AUTO_SAMPLE_RUNES))
+	if home, partner, ok := autoPair(preset); ok {
+		return source, pairTarget(home, partner, source)
+	}
+	return source, langdetect.Code(settings.TargetLanguage)
+}
+
+// presetPrompt 返回预设处理 sample 时使用的 System Prompt。
+// 自动互译预设按检测到的语言决定翻译方向，同时返回方向说明 (如 "日语 → 中文")，其他预设的说明为空
+func presetPrompt(preset config.PresetItem, settings models.UserSettings, sample string) (prompt, direction string) {
+	home, partner, ok := autoPair(preset)
+	if !ok {
+		content := preset.Content
+		if content == "" {
+			content = DEFAULT_SYSTEM_PROMPT
+		}
+		return systemPrompt(content, settings), ""
+	}
+
+	source := langdetect.Detect(truncateRunes(sample, AUTO_SAMPLE_RUNES))
+	target := pairTarget(home, partner, source)
+
+	content := preset.Content
+	if content == "" {
+		content = AUTO_PAIR_PROMPT
+	}
+	var instruction string
+	if source == "" {
+		instruction = fmt.Sprintf("请将用户发送的内容翻译成%s。", langdetect.Name(target))
+		direction = "→ " + langdetect.Name(target)
+	} else {
+		instruction = fmt.Sprintf("用户发送的内容为%s，请将其翻译成%s。", langdetect.Name(source), langdetect.Name(target))
+		direction = langdetect.Name(source) + " → " + langdetect.Name(target)
+	}
+
+	// 翻译方向由语言对决定，不使用设置中的目标语言
+	settings.TargetLanguage = ""
+	return systemPrompt(strings.TrimSpace(content)+"\n\n"+instruction, settings), direction
+}
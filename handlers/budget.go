@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"tg-bot-go/config"
+	"tg-bot-go/llm"
+	"tg-bot-go/tokenizer"
+)
+
+// contextBudget 返回本次请求中提示词、历史与用户消息可以使用的 token 数：
+// 模型的上下文窗口减去为回复预留的部分，且不超过 CONTEXT_MAX_TOKENS
+func (h *Handler) contextBudget(model string, preset config.PresetItem) int {
+	reserve := config.Config.Context.ReserveTokens
+	if preset.MaxTokens > 0 {
+		reserve = preset.MaxTokens
+	}
+	budget := h.Tokens.ContextWindow(model) - reserve
+	if limit := config.Config.Context.MaxTokens; limit > 0 && budget > limit {
+		budget = limit
+	}
+	return budget
+}
+
+// messageTokens 返回一条消息在该模型下占用的 token 数 (含消息格式的固定开销与图片)
+func (h *Handler) messageTokens(model string, msg llm.Message) int {
+	return h.Tokens.Count(model, msg.Content) + tokenizer.MessageOverhead + len(msg.Images)*tokenizer.ImageTokens
+}
@@ -1,57 +1,50 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"tg-bot-go/config"
 	"tg-bot-go/logger"
-	"tg-bot-go/models"
-	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // HandleCallback 处理回调查询
-func (h *Handler) HandleCallback(update tgbotapi.Update) {
+func (h *Handler) HandleCallback(ctx context.Context, update tgbotapi.Update) {
 	callback := update.CallbackQuery
 	chatID := callback.Message.Chat.ID
+	userID := callback.From.ID
 	data := callback.Data
 
-	// 检查用户是否在白名单中
-	var whitelistUser models.WhitelistUser
-	if err := h.DB.Where("user_id = ?", chatID).First(&whitelistUser).Error; err != nil {
-		msg := tgbotapi.NewMessage(chatID, "您没有权限使用此机器人。")
-		h.Bot.Send(msg)
+	// “停止”按钮只作用于点击者自己的处理，无需鉴权
+	if data == CANCEL_COMMAND {
+		h.handleCancelCallback(ctx, callback)
+		return
+	}
+
+	// 检查点击按钮的用户是否在白名单中且未过期 (群聊中按钮会修改整个群的预设)
+	s := h.withLang(ctx, session{ChatID: chatID, UserID: userID})
+	if !h.checkUserValid(ctx, s) {
+		return
+	}
+
+	// 用户自定义预设的按钮
+	if strings.HasPrefix(data, userPresetCallback) {
+		h.handleUserPresetCallback(ctx, s, callback)
 		return
 	}
 
 	switch data {
 	case "/help":
-		msg := tgbotapi.NewMessage(chatID, "这里是帮助信息...")
-		h.Bot.Send(msg)
+		h.Bot.Send(s.reply("这里是帮助信息..."))
 	case "/about":
-		msg := tgbotapi.NewMessage(chatID, "关于我们...")
-		h.Bot.Send(msg)
+		h.Bot.Send(s.reply("关于我们..."))
 	default:
-		// 处理预设命令
-		for _, item := range config.Config.Presets.Items {
+		// 处理预设命令，保存选择并清空对话上下文
+		for _, item := range config.Presets() {
 			if data == item.Command {
-				// 保存用户选择的预设
-				presetKey := fmt.Sprintf("user:%d:preset", chatID)
-				if err := h.Redis.Set(ctx, presetKey, item.Content, 24*time.Hour).Err(); err != nil {
-					logger.LogRuntime(fmt.Sprintf("Failed to save preset: %v", err))
-					msg := tgbotapi.NewMessage(chatID, "设置预设失败，请稍后再试。")
-					h.Bot.Send(msg)
-					return
-				}
-
-				// 清空对话上下文
-				contextKey := fmt.Sprintf("user:%d:context", chatID)
-				if err := h.Redis.Del(ctx, contextKey).Err(); err != nil {
-					logger.LogRuntime(fmt.Sprintf("Failed to delete context: %v", err))
-				}
-
-				msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("已切换到%s，您可以开始对话了。", item.Button))
-				h.Bot.Send(msg)
+				h.handlePresetCommand(ctx, s, item)
 				return
 			}
 		}
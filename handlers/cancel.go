@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"tg-bot-go/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// CANCEL_COMMAND 中止命令，同时用作“停止”按钮的回调数据
+const CANCEL_COMMAND = "/cancel"
+
+// errStoppedByUser 用户通过 /cancel 或“停止”按钮中止了处理
+var errStoppedByUser = errors.New("stopped by user")
+
+// generation 一次可被用户中止的处理
+type generation struct {
+	cancel context.CancelCauseFunc
+}
+
+// generations 按“聊天 + 用户”记录正在进行的处理
+type generations struct {
+	mu      sync.Mutex
+	running map[string]*generation
+}
+
+func generationKey(chatID, userID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+// startGeneration 登记一次可中止的处理，返回派生的 ctx，处理结束后必须调用 done
+func (h *Handler) startGeneration(ctx context.Context, s session) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := generationKey(s.ChatID, s.UserID)
+	g := &generation{cancel: cancel}
+
+	h.generations.mu.Lock()
+	if h.generations.running == nil {
+		h.generations.running = make(map[string]*generation)
+	}
+	h.generations.running[key] = g
+	h.generations.mu.Unlock()
+
+	return ctx, func() {
+		h.generations.mu.Lock()
+		if h.generations.running[key] == g {
+			delete(h.generations.running, key)
+		}
+		h.generations.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancelGeneration 中止用户在该聊天中正在进行的处理，没有正在进行的处理时返回 false
+func (h *Handler) cancelGeneration(chatID, userID int64) bool {
+	h.generations.mu.Lock()
+	defer h.generations.mu.Unlock()
+	g, ok := h.generations.running[generationKey(chatID, userID)]
+	if !ok {
+		return false
+	}
+	g.cancel(errStoppedByUser)
+	return true
+}
+
+// IsCancelRequest 判断更新是否为中止请求；这类更新需要绕过按用户串行的队列，
+// 否则会排在被中止的处理之后
+func (h *Handler) IsCancelRequest(update tgbotapi.Update) bool {
+	switch {
+	case update.Message != nil:
+		command, ok := h.parseCommand(update.Message.Text)
+		return ok && command == CANCEL_COMMAND
+	case update.CallbackQuery != nil:
+		return update.CallbackQuery.Data == CANCEL_COMMAND
+	}
+	return false
+}
+
+// handleCancelCommand 处理 /cancel，同时退出创建或编辑预设的向导
+func (h *Handler) handleCancelCommand(ctx context.Context, s session) {
+	if h.clearPresetDraft(ctx, s) {
+		h.Bot.Send(s.reply("已取消编辑预设。"))
+		return
+	}
+	if h.cancelGeneration(s.ChatID, s.UserID) {
+		h.Bot.Send(s.reply("已停止。"))
+		return
+	}
+	h.Bot.Send(s.reply("当前没有正在进行的任务。"))
+}
+
+// handleCancelCallback 处理“停止”按钮，只能中止点击者自己的处理
+func (h *Handler) handleCancelCallback(ctx context.Context, callback *tgbotapi.CallbackQuery) {
+	text := "已停止。"
+	if !h.cancelGeneration(callback.Message.Chat.ID, callback.From.ID) {
+		text = "当前没有您正在进行的任务。"
+	}
+	lang := h.loadSettings(ctx, callback.Message.Chat.ID).UILanguage
+	if _, err := h.Bot.Request(tgbotapi.NewCallback(callback.ID, tr(lang, text))); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Error answering callback query: %v", err))
+	}
+}
+
+// stopKeyboard 附在生成中的占位消息上的“停止”按钮
+func stopKeyboard(lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(tr(lang, "⏹ 停止"), CANCEL_COMMAND),
+	))
+}
+
+// isStopped 判断 ctx 是否因用户中止而结束
+func isStopped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errStoppedByUser)
+}
+
+// failureText 根据 ctx 的结束原因选择提示：用户中止、超时、服务重启，否则返回 fallback；
+// 返回中文原文，由发送方按界面语言翻译
+func failureText(ctx context.Context, fallback string) string {
+	switch {
+	case isStopped(ctx):
+		return "已停止。"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "处理超时，请缩短内容后再试。"
+	case ctx.Err() != nil:
+		return "服务正在重启，请稍后再试。"
+	}
+	return fallback
+}
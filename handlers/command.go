@@ -1,22 +1,27 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"tg-bot-go/config"
 	"tg-bot-go/logger"
-	"time"
+	"tg-bot-go/models"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // handleCommand 处理通用命令
-func (h *Handler) handleCommand(update tgbotapi.Update) {
+func (h *Handler) handleCommand(ctx context.Context, s session, update tgbotapi.Update) {
+	// 频道消息与匿名管理员没有可鉴权的发送者
+	if update.Message.From == nil {
+		return
+	}
 	chatID := update.Message.Chat.ID
+	userID := update.Message.From.ID
 	text := update.Message.Text
 
-	// 获取命令部分（第一个空格前的内容）
-	command := strings.Fields(text)[0]
+	// 获取命令部分（第一个空格前的内容，去掉 @botname）
+	command, _ := h.parseCommand(text)
 
 	switch command {
 	case "/start", "/help", "/about":
@@ -30,105 +35,115 @@ func (h *Handler) handleCommand(update tgbotapi.Update) {
 			responseText = "关于我们..."
 		}
 
-		msg := tgbotapi.NewMessage(chatID, responseText)
+		msg := s.reply(responseText)
 
 		if command == "/start" {
-			// 创建 Inline Keyboard
-			var buttons [][]tgbotapi.InlineKeyboardButton
-			for _, item := range config.Config.Presets.Items {
-				button := tgbotapi.NewInlineKeyboardButtonData(item.Button, item.Command)
-				buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
-			}
-
-			// 添加帮助和关于按钮
-			helpAboutRow := []tgbotapi.InlineKeyboardButton{
-				tgbotapi.NewInlineKeyboardButtonData("帮助", "/help"),
-				tgbotapi.NewInlineKeyboardButtonData("关于", "/about"),
-			}
-			buttons = append(buttons, helpAboutRow)
-
-			inlineMsg := tgbotapi.NewMessage(chatID, responseText)
-			inlineMsg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
-			h.Bot.Send(inlineMsg)
-
-			// 添加底部键盘
-			clearKeyboard := tgbotapi.NewReplyKeyboard(
-				tgbotapi.NewKeyboardButtonRow(
-					tgbotapi.NewKeyboardButton("/clear"),
-				),
-			)
-			clearKeyboard.ResizeKeyboard = true
-			return
+			// 创建 Inline Keyboard (全局预设与用户自己的预设)
+			msg.ReplyMarkup = h.presetKeyboard(ctx, s)
 		}
 
 		h.Bot.Send(msg)
 
 	case "/clear":
-		// 清空对话上下文和预设
-		contextKey := fmt.Sprintf("user:%d:context", chatID)
-		presetKey := fmt.Sprintf("user:%d:preset", chatID)
-
-		if err := h.Redis.Del(ctx, contextKey, presetKey).Err(); err != nil {
-			logger.LogRuntime(fmt.Sprintf("Failed to delete Redis context and preset: %v", err))
-			msg := tgbotapi.NewMessage(chatID, "清空上下文失败，请稍后再试。")
-			h.Bot.Send(msg)
+		// 清空对话上下文和预设 (群聊中预设对整个群生效，需要鉴权)
+		if !h.checkUserValid(ctx, s) {
 			return
 		}
-
-		msg := tgbotapi.NewMessage(chatID, "已清空所有对话上下文和预设。")
-		var buttons [][]tgbotapi.InlineKeyboardButton
-		for _, item := range config.Config.Presets.Items {
-			button := tgbotapi.NewInlineKeyboardButtonData(item.Button, item.Command)
-			buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
+		err := h.Redis.Del(ctx, h.Keys.context(chatID, userID), h.Keys.summary(chatID, userID)).Err()
+		if err == nil {
+			err = h.updateSettings(ctx, chatID, func(u *models.UserSettings) { u.Preset = "" })
 		}
-		helpAboutRow := []tgbotapi.InlineKeyboardButton{
-			tgbotapi.NewInlineKeyboardButtonData("帮助", "/help"),
-			tgbotapi.NewInlineKeyboardButtonData("关于", "/about"),
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to clear context and preset: %v", err))
+			h.Bot.Send(s.reply("清空上下文失败，请稍后再试。"))
+			return
 		}
-		buttons = append(buttons, helpAboutRow)
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(buttons...)
+
+		msg := s.reply("已清空所有对话上下文和预设。")
+		msg.ReplyMarkup = h.presetKeyboard(ctx, s)
 		h.Bot.Send(msg)
 
+	case "/settings":
+		if h.checkUserValid(ctx, s) {
+			h.handleSettingsCommand(ctx, s, isGroupChat(update.Message.Chat))
+		}
+
+	case "/set":
+		if h.checkUserValid(ctx, s) {
+			h.handleSetCommand(ctx, s, update.Message.CommandArguments())
+		}
+
+	case "/glossary":
+		if h.checkUserValid(ctx, s) {
+			h.handleGlossaryCommand(ctx, s, update.Message.CommandArguments())
+		}
+
+	case "/newpreset", "/mypresets", "/importpreset":
+		if !h.checkUserValid(ctx, s) {
+			return
+		}
+		switch command {
+		case "/newpreset":
+			h.handleNewPresetCommand(ctx, s)
+		case "/mypresets":
+			h.handleMyPresetsCommand(ctx, s)
+		case "/importpreset":
+			h.handleImportPresetCommand(ctx, s, update.Message.CommandArguments())
+		}
+
+	case "/memory":
+		h.handleMemoryCommand(ctx, s, update.Message.CommandArguments())
+
+	case "/gpreset":
+		h.handleGlobalPresetCommand(ctx, s, update.Message.CommandArguments())
+
+	case "/presetqueue", "/approvepreset", "/rejectpreset", "/disablepreset":
+		h.handlePresetAdminCommand(ctx, s, command, update.Message.CommandArguments())
+
+	case CANCEL_COMMAND:
+		h.handleCancelCommand(ctx, s)
+
 	case "/expiry":
-		h.handleExpiryCommand(update)
+		h.handleExpiryCommand(ctx, s)
 
 	case "/id":
-		msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("您的用户ID是：%d", chatID))
-		h.Bot.Send(msg)
+		responseText := s.trf("您的用户ID是：%d", userID)
+		if isGroupChat(update.Message.Chat) {
+			responseText += s.trf("\n当前群组ID是：%d", chatID)
+		}
+		h.Bot.Send(s.reply(responseText))
 
 	case "/adduser", "/deleteuser", "/extend", "/checkuser":
-		h.handleAdminCommand(update)
+		h.handleAdminCommand(ctx, update)
 
 	default:
 		// 处理预设命令
-		for _, item := range config.Config.Presets.Items {
+		for _, item := range config.Presets() {
 			if command == item.Command {
-				h.handlePresetCommand(update, item)
+				if h.checkUserValid(ctx, s) {
+					h.handlePresetCommand(ctx, s, item)
+				}
 				return
 			}
 		}
 	}
 }
 
-// handlePresetCommand 处理预设命令
-func (h *Handler) handlePresetCommand(update tgbotapi.Update, preset config.PresetItem) {
-	chatID := update.Message.Chat.ID
+// handlePresetCommand 处理预设命令，调用方负责鉴权
+func (h *Handler) handlePresetCommand(ctx context.Context, s session, preset config.PresetItem) {
+	chatID, userID := s.ChatID, s.UserID
 
-	// 保存用户选择的预设
-	presetKey := fmt.Sprintf("user:%d:preset", chatID)
-	if err := h.Redis.Set(ctx, presetKey, preset.Content, 24*time.Hour).Err(); err != nil {
+	// 保存用户选择的预设 (群聊中对整个群生效)
+	if err := h.updateSettings(ctx, chatID, func(u *models.UserSettings) { u.Preset = preset.Command }); err != nil {
 		logger.LogRuntime(fmt.Sprintf("Failed to save preset: %v", err))
-		msg := tgbotapi.NewMessage(chatID, "设置预设失败，请稍后再试。")
-		h.Bot.Send(msg)
+		h.Bot.Send(s.reply("设置预设失败，请稍后再试。"))
 		return
 	}
 
 	// 清空对话上下文
-	contextKey := fmt.Sprintf("user:%d:context", chatID)
-	if err := h.Redis.Del(ctx, contextKey).Err(); err != nil {
+	if err := h.Redis.Del(ctx, h.Keys.context(chatID, userID), h.Keys.summary(chatID, userID)).Err(); err != nil {
 		logger.LogRuntime(fmt.Sprintf("Failed to delete context: %v", err))
 	}
 
-	msg := tgbotapi.NewMessage(chatID, fmt.Sprintf("已切换到%s，您可以开始对话了。", preset.Button))
-	h.Bot.Send(msg)
+	h.Bot.Send(s.replyf("已切换到%s，您可以开始对话了。", preset.Button))
 }
\ No newline at end of file
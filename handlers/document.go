@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tg-bot-go/document"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	DOCUMENT_CHUNK_SIZE  = 1500 // 每个分块的最大长度 (chars)
+	DOCUMENT_CONCURRENCY = 4    // 单个文档同时翻译的分块数
+	DOCUMENT_MAX_CHUNKS  = 200  // 单个文档最多分块数，超过视为文件过大
+
+	documentInstruction = "\n\n输入是文档的一部分。请只输出译文，保持原有的段落划分、换行和 Markdown 格式，段落之间用空行分隔，不要添加任何解释。"
+)
+
+// handleDocument 按段落分块并行翻译文档，按原顺序拼接后以同样的格式发回
+func (h *Handler) handleDocument(ctx context.Context, s session, message *tgbotapi.Message) {
+	doc := message.Document
+
+	format, ok := document.DetectFormat(doc.FileName)
+	if !ok {
+		h.Bot.Send(s.reply("暂不支持该文件格式，目前支持 .txt、.md、.docx 以及 .srt、.vtt 字幕。"))
+		return
+	}
+
+	preset, settings := h.activePreset(ctx, s.ChatID)
+	if preset.Content == "" {
+		h.Bot.Send(s.reply("请先通过 /start 选择一个翻译模式，再发送文件。"))
+		return
+	}
+	// 文件与字幕依赖分段标记拆分译文，不使用预设的输出格式与停止序列
+	preset.ResponseFormat, preset.Stop = "", nil
+
+	data, err := h.downloadFile(ctx, doc.FileID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to download document: %v", err))
+		h.Bot.Send(s.reply("下载文件失败，请稍后再试。"))
+		return
+	}
+	logger.LogUserMessage(s.UserID, fmt.Sprintf("[文件] %s (%d bytes)", doc.FileName, len(data)))
+
+	// 字幕文件逐条翻译并保留序号与时间轴
+	if format.IsSubtitle() {
+		h.handleSubtitle(ctx, s, message, preset, settings, format, data)
+		return
+	}
+
+	// 解析文档并分块
+	var docx *document.Docx
+	var chunks [][]string
+	if format == document.FormatDocx {
+		docx, err = document.ReadDocx(data)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to parse docx: %v", err))
+			h.Bot.Send(s.reply("无法解析该 .docx 文件。"))
+			return
+		}
+		// docx 需要逐段回填，因此不切分段落
+		chunks = document.Group(docx.Paragraphs, DOCUMENT_CHUNK_SIZE)
+	} else {
+		if !utf8.Valid(data) {
+			h.Bot.Send(s.reply("文件不是 UTF-8 编码，请转换后再发送。"))
+			return
+		}
+		chunks = document.Chunk(document.SplitParagraphs(string(data)), DOCUMENT_CHUNK_SIZE)
+	}
+
+	if len(chunks) == 0 {
+		h.Bot.Send(s.reply("文件中没有可翻译的内容。"))
+		return
+	}
+	if len(chunks) > DOCUMENT_MAX_CHUNKS {
+		h.Bot.Send(s.reply("文件过大，请拆分后再发送。"))
+		return
+	}
+
+	// 自动互译预设按文档开头的内容决定翻译方向
+	prompt, direction := presetPrompt(preset, settings, strings.Join(chunks[0], "\n"))
+	title := s.trf("正在翻译 %s", doc.FileName)
+	if direction != "" {
+		title += fmt.Sprintf("（%s）", direction)
+	}
+	progress := h.newProgress(s, title, len(chunks))
+	provider := h.providerFor(preset, settings)
+	// docx 的每个段落带有编号，按编号回填译文，模型合并或拆分段落时不会打乱版式
+	inputs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if docx != nil {
+			inputs[i] = document.EncodeParagraphs(chunk)
+		} else {
+			inputs[i] = strings.Join(chunk, "\n\n")
+		}
+	}
+	instruction := documentInstruction
+	if docx != nil {
+		instruction = document.ParagraphInstruction
+	}
+	results, err := h.translateChunks(ctx, provider, prompt+instruction, inputs, progress.Done)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Document translation error (%s): %v", provider.Name(), err))
+		progress.Finish(failureText(ctx, "翻译文件失败，请稍后再试。"))
+		return
+	}
+
+	// 按原格式重新组装
+	var output []byte
+	if docx != nil {
+		var paragraphs []string
+		for i, chunk := range chunks {
+			translated, missing := document.DecodeParagraphs(results[i], chunk)
+			if missing > 0 {
+				logger.LogRuntime(fmt.Sprintf("Document chunk %d: %d paragraphs missing from translation, kept original", i, missing))
+			}
+			paragraphs = append(paragraphs, translated...)
+		}
+		output, err = docx.Write(paragraphs)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to write docx: %v", err))
+			progress.Finish("生成译文文件失败。")
+			return
+		}
+	} else {
+		output = []byte(strings.Join(results, "\n\n") + "\n")
+	}
+
+	progress.Finish(s.trf("%s 翻译完成。", doc.FileName))
+	reply := tgbotapi.NewDocument(s.ChatID, tgbotapi.FileBytes{
+		Name:  translatedFileName(doc.FileName),
+		Bytes: output,
+	})
+	reply.ReplyToMessageID = message.MessageID
+	if _, err := h.Bot.Send(reply); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send translated document: %v", err))
+	}
+}
+
+// translateChunks 并行翻译各分块，结果与 inputs 顺序一致；任一分块失败即取消其余分块并返回错误
+func (h *Handler) translateChunks(ctx context.Context, provider llm.Provider, systemPrompt string, inputs []string, onDone func()) ([]string, error) {
+	results := make([]string, len(inputs))
+	err := runParallel(ctx, len(inputs), DOCUMENT_CONCURRENCY, func(ctx context.Context, i int) error {
+		text, err := provider.Chat(ctx, &llm.Request{Messages: []llm.Message{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: inputs[i]},
+		}})
+		if err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		results[i] = strings.TrimSpace(text)
+		return nil
+	}, onDone)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// runParallel 以最多 concurrency 个并发执行 fn(ctx, 0..n-1)，每完成一个调用 onDone；
+// 出现错误后取消传给 fn 的 ctx，不再启动新的任务，并返回第一个错误
+func runParallel(ctx context.Context, n, concurrency int, fn func(ctx context.Context, i int) error, onDone func()) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	started := 0
+	for ; started < n; started++ {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := fn(ctx, i)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			if onDone != nil {
+				onDone()
+			}
+		}(started)
+	}
+	wg.Wait()
+	if firstErr == nil && started < n {
+		// 外部取消导致部分任务没有启动
+		return parent.Err()
+	}
+	return firstErr
+}
+
+func translatedFileName(name string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".translated" + ext
+}
+
+// progressMessage 通过编辑同一条消息展示进度，编辑频率受 STREAM_EDIT_INTERVAL 限制
+type progressMessage struct {
+	bot       *tgbotapi.BotAPI
+	chatID    int64
+	messageID int
+	title     string
+	total     int
+	lang      string // 界面语言，用于按钮与结果提示
+
+	mu       sync.Mutex
+	done     int
+	lastEdit time.Time
+}
+
+func (h *Handler) newProgress(s session, title string, total int) *progressMessage {
+	p := &progressMessage{
+		bot:      h.Bot,
+		chatID:   s.ChatID,
+		title:    title,
+		total:    total,
+		lang:     s.Lang,
+		lastEdit: time.Now(),
+	}
+	msg := s.reply(p.text())
+	msg.ReplyMarkup = stopKeyboard(s.Lang)
+	sent, err := h.Bot.Send(msg)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send progress message: %v", err))
+	}
+	p.messageID = sent.MessageID
+	return p
+}
+
+// Done 标记一个分块完成
+func (p *progressMessage) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if p.done < p.total && time.Since(p.lastEdit) < STREAM_EDIT_INTERVAL {
+		return
+	}
+	p.edit(p.text(), true)
+}
+
+// Finish 用最终状态替换进度消息并移除“停止”按钮，text 按界面语言翻译
+func (p *progressMessage) Finish(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.edit(tr(p.lang, text), false)
+}
+
+func (p *progressMessage) text() string {
+	return fmt.Sprintf("%s… %d/%d", p.title, p.done, p.total)
+}
+
+func (p *progressMessage) edit(text string, keyboard bool) {
+	if p.messageID == 0 {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(p.chatID, p.messageID, text)
+	if keyboard {
+		markup := stopKeyboard(p.lang)
+		edit.ReplyMarkup = &markup
+	}
+	if _, err := p.bot.Send(edit); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to edit progress message: %v", err))
+	}
+	p.lastEdit = time.Now()
+}
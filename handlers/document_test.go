@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunParallelCancelsOnFirstError(t *testing.T) {
+	boom := errors.New("boom")
+	var started, cancelled atomic.Int32
+	err := runParallel(context.Background(), 10, 2, func(ctx context.Context, i int) error {
+		started.Add(1)
+		if i == 0 {
+			return boom
+		}
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}, nil)
+
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected first error, got %v", err)
+	}
+	if started.Load() >= 10 {
+		t.Fatalf("remaining tasks should not start after a failure, started %d", started.Load())
+	}
+	if started.Load() > 1 && cancelled.Load() == 0 {
+		t.Fatal("running tasks should observe cancellation")
+	}
+}
+
+func TestRunParallelCompletes(t *testing.T) {
+	var done atomic.Int32
+	results := make([]int, 5)
+	err := runParallel(context.Background(), 5, 2, func(ctx context.Context, i int) error {
+		results[i] = i * i
+		return nil
+	}, func() { done.Add(1) })
+	if err != nil || done.Load() != 5 || results[4] != 16 {
+		t.Fatalf("unexpected result: err=%v done=%d results=%v", err, done.Load(), results)
+	}
+}
+
+func TestRunParallelParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := runParallel(ctx, 3, 1, func(ctx context.Context, i int) error { return nil }, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
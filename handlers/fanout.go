@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"tg-bot-go/config"
+	"tg-bot-go/langdetect"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MAX_FANOUT_TARGETS = 5 // 多语言同时翻译最多的目标语言数
+	MIN_FANOUT_TARGETS = 2
+)
+
+// fanOutTargets 返回设置中的多个目标语言，未开启多语言翻译时为空
+func fanOutTargets(settings models.UserSettings) []string {
+	if settings.Targets == "" {
+		return nil
+	}
+	return strings.Split(settings.Targets, ",")
+}
+
+// parseFanOutTargets 解析 /set targets 的值，语言代码 (如 en、ja) 转为中文名称，返回以逗号连接的结果；
+// 错误信息按界面语言 lang 给出
+func parseFanOutTargets(lang, value string) (string, error) {
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '，' || r == '+' || r == ' '
+	})
+	var targets []string
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		name := field
+		if code := strings.ToLower(field); langdetect.Supported(code) {
+			name = langdetect.Name(code)
+		}
+		if utf8.RuneCountInString(name) > MAX_TARGET_LANGUAGE {
+			return "", errors.New(trf(lang, "目标语言最多 %d 个字符。", MAX_TARGET_LANGUAGE))
+		}
+		if !seen[name] {
+			seen[name] = true
+			targets = append(targets, name)
+		}
+	}
+	if len(targets) < MIN_FANOUT_TARGETS || len(targets) > MAX_FANOUT_TARGETS {
+		return "", errors.New(trf(lang, "请设置 %d 到 %d 个不同的目标语言，用逗号分隔，例如 en,ja,ru。", MIN_FANOUT_TARGETS, MAX_FANOUT_TARGETS))
+	}
+	return strings.Join(targets, ","), nil
+}
+
+// fanOut 使用当前预设将一条消息并行翻译为多个目标语言，按设置中的顺序合并为一条回复。
+// 各语言的译文互相独立，不写入对话上下文
+func (h *Handler) fanOut(ctx context.Context, s session, preset config.PresetItem, settings models.UserSettings, targets []string, userMsg llm.Message) {
+	writer, err := h.newStreamWriter(s)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send placeholder message: %v", err))
+		return
+	}
+
+	provider := h.providerFor(preset, settings)
+	if len(userMsg.Images) > 0 && !llm.SupportsVision(provider) {
+		writer.Fail("当前模型不支持图片输入。")
+		return
+	}
+
+	// 目标语言由设置决定，不使用自动互译的方向
+	preset.Pair = nil
+	var mu sync.Mutex
+	results := make([]string, len(targets))
+	failed := make([]bool, len(targets))
+	runParallel(ctx, len(targets), MAX_FANOUT_TARGETS, func(ctx context.Context, i int) error {
+		targetSettings := settings
+		targetSettings.TargetLanguage = targets[i]
+		prompt, _ := presetPrompt(preset, targetSettings, userMsg.Content)
+		source, target := translationLanguages(preset, targetSettings, userMsg.Content)
+		glossary := h.matchGlossary(ctx, s.ChatID, userMsg.Content, source, target)
+		prompt += glossaryPrompt(glossary)
+
+		// 与单语言翻译共用翻译记忆，命中时不调用大模型
+		var (
+			response, suffix string
+			err              error
+			exact            *models.TranslationMemory
+			similar          []models.TranslationMemory
+		)
+		scope, useMemory := memoryScope(preset, prompt, source, target, userMsg)
+		if useMemory {
+			exact, similar = h.lookupMemory(ctx, scope, userMsg.Content, len(glossary) > 0)
+		}
+		if exact != nil {
+			response = exact.Target
+			suffix = "\n\n" + s.tr(MEMORY_HIT_MARK)
+		} else {
+			response, err = provider.Chat(ctx, &llm.Request{Messages: []llm.Message{
+				{Role: "system", Content: prompt + memoryPrompt(similar)},
+				userMsg,
+			}})
+			if err == nil {
+				suffix = glossaryWarning(s.Lang, glossary, response)
+				if useMemory && suffix == "" {
+					h.rememberTranslation(ctx, scope, userMsg.Content, response)
+				}
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Fan-out translation error (%s, %s): %v", provider.Name(), targets[i], err))
+			failed[i] = true
+		} else {
+			results[i] = strings.TrimSpace(response) + suffix
+		}
+		// 完成一种语言后刷新回复，与流式输出一样受 STREAM_EDIT_INTERVAL 限制；全部完成后由 Finish 写入最终结果
+		if time.Since(writer.lastEdit) >= STREAM_EDIT_INTERVAL {
+			writer.edit(truncateRunes(fanOutText(s.Lang, targets, results, failed, true), MAX_MESSAGE_LENGTH), true)
+		}
+		return nil
+	}, nil)
+
+	allFailed := true
+	for _, f := range failed {
+		allFailed = allFailed && f
+	}
+	if allFailed {
+		writer.Fail(failureText(ctx, "翻译失败，请稍后再试。"))
+		return
+	}
+	response := fanOutText(s.Lang, targets, results, failed, false)
+	if isStopped(ctx) {
+		// 用户中止时保留已完成的语言
+		response += s.tr("\n\n（已停止）")
+	}
+	writer.Finish(response)
+	logger.LogUserMessage(s.UserID, response)
+}
+
+// fanOutText 按目标语言分节显示译文，pending 为 true 时未完成的语言显示为“翻译中”
+func fanOutText(lang string, targets, results []string, failed []bool, pending bool) string {
+	var b strings.Builder
+	for i, target := range targets {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "【%s】\n", target)
+		switch {
+		case failed[i]:
+			b.WriteString(tr(lang, "（翻译失败）"))
+		case results[i] != "":
+			b.WriteString(results[i])
+		case pending:
+			b.WriteString(tr(lang, "翻译中…"))
+		}
+	}
+	return b.String()
+}
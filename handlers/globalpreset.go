@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/langdetect"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+
+	"gorm.io/gorm"
+)
+
+const gpresetUsage = `用法：
+/gpreset list - 查看全部全局预设
+/gpreset add <命令> <按钮名>（换行后为提示词）- 新增预设
+/gpreset edit <命令> <字段> <值> - 修改预设，content 可换行
+  字段：button、content、provider、model、temperature、top_p、max_tokens、stop（多个用 | 分隔）、response_format（text / json）、pair（自动互译的语言对，如 zh,ja），生成参数与 pair 的值留空时恢复默认
+/gpreset move <命令> <序号> - 调整顺序
+/gpreset disable <命令> / enable <命令> - 停用或启用
+/gpreset reset <命令> - 删除数据库中的修改，恢复为 presets.toml 中的定义`
+
+// presetCommandPattern Telegram 命令只能包含小写字母、数字和下划线
+var presetCommandPattern = regexp.MustCompile(`^/[a-z0-9_]{1,32}$`)
+
+// reservedCommands 机器人自身的命令，不能用作预设命令
+var reservedCommands = map[string]bool{
+	"/start": true, "/help": true, "/about": true, "/clear": true, "/expiry": true, "/id": true,
+	"/tr": true, "/settings": true, "/set": true, "/cancel": true, "/glossary": true, "/memory": true, "/gpreset": true,
+	"/newpreset": true, "/mypresets": true, "/importpreset": true,
+	"/presetqueue": true, "/approvepreset": true, "/rejectpreset": true, "/disablepreset": true,
+	"/adduser": true, "/deleteuser": true, "/extend": true, "/checkuser": true,
+}
+
+// handleGlobalPresetCommand 处理 /gpreset，管理员维护保存在数据库中的全局预设
+func (h *Handler) handleGlobalPresetCommand(ctx context.Context, s session, args string) {
+	if !h.isAdmin(ctx, s.UserID) {
+		h.Bot.Send(s.reply("您没有管理员权限。"))
+		return
+	}
+
+	// 第一行为子命令与参数，之后的内容 (如提示词) 原样保留
+	firstLine, rest, _ := strings.Cut(args, "\n")
+	fields := strings.Fields(firstLine)
+	if len(fields) == 0 {
+		h.Bot.Send(s.reply(gpresetUsage))
+		return
+	}
+	action := strings.ToLower(fields[0])
+	if action == "list" {
+		h.listGlobalPresets(s)
+		return
+	}
+	if len(fields) < 2 {
+		h.Bot.Send(s.reply(gpresetUsage))
+		return
+	}
+	command := strings.ToLower(fields[1])
+	db := h.DB.WithContext(ctx)
+
+	var err error
+	var done string
+	switch action {
+	case "add":
+		if !presetCommandPattern.MatchString(command) || reservedCommands[command] {
+			h.Bot.Send(s.reply("命令格式错误或与内置命令冲突，只能包含小写字母、数字和下划线，例如 /english_to_chinese。"))
+			return
+		}
+		if _, exists := findPresetEntry(command); exists {
+			h.Bot.Send(s.reply("该预设已存在，请使用 /gpreset edit 修改。"))
+			return
+		}
+		button := strings.TrimSpace(strings.Join(fields[2:], " "))
+		if button == "" {
+			h.Bot.Send(s.reply(gpresetUsage))
+			return
+		}
+		content := strings.TrimSpace(rest)
+		err = models.UpsertGlobalPreset(db, command, map[string]interface{}{"button": button, "content": content, "disabled": false})
+		done = fmt.Sprintf("已新增预设 %s。", command)
+
+	case "edit":
+		if _, exists := findPresetEntry(command); !exists || len(fields) < 3 {
+			h.Bot.Send(s.reply("预设不存在或格式错误。\n\n" + gpresetUsage))
+			return
+		}
+		field := strings.ToLower(fields[2])
+		value := strings.TrimSpace(strings.Join(fields[3:], " "))
+		if rest != "" {
+			value = strings.TrimSpace(value + "\n" + rest)
+		}
+		if field == "provider" {
+			if name, _, _ := strings.Cut(value, ":"); value != "" && !h.LLM.Has(name) {
+				h.Bot.Send(s.replyf("未配置该后端，可用：%s。", strings.Join(h.LLM.Names(), ", ")))
+				return
+			}
+		}
+		column, parsed, msg := parsePresetField(field, value)
+		if msg != "" {
+			h.Bot.Send(s.reply(msg))
+			return
+		}
+		err = models.UpsertGlobalPreset(db, command, map[string]interface{}{column: parsed})
+		done = fmt.Sprintf("已修改预设 %s 的 %s。", command, field)
+
+	case "move":
+		position := 0
+		if len(fields) >= 3 {
+			position, _ = strconv.Atoi(fields[2])
+		}
+		if position <= 0 {
+			h.Bot.Send(s.reply("序号必须是大于 0 的整数。"))
+			return
+		}
+		err = moveGlobalPreset(db, command, position)
+		done = fmt.Sprintf("已将预设 %s 移到第 %d 位。", command, position)
+
+	case "disable", "enable":
+		if _, exists := findPresetEntry(command); !exists {
+			h.Bot.Send(s.reply("预设不存在。"))
+			return
+		}
+		err = models.UpsertGlobalPreset(db, command, map[string]interface{}{"disabled": action == "disable"})
+		done = fmt.Sprintf("已%s预设 %s。", map[string]string{"disable": "停用", "enable": "启用"}[action], command)
+
+	case "reset":
+		err = models.DeleteGlobalPreset(db, command)
+		done = fmt.Sprintf("预设 %s 已恢复为 presets.toml 中的定义。", command)
+
+	default:
+		h.Bot.Send(s.reply(gpresetUsage))
+		return
+	}
+
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to update global preset %s: %v", command, err))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.Bot.Send(s.reply("预设不存在。"))
+		} else {
+			h.Bot.Send(s.reply("保存预设失败，请稍后再试。"))
+		}
+		return
+	}
+	// 立即在本实例生效，其他实例在下一次轮询时同步
+	if err := config.ReloadDBPresets(db); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to reload presets: %v", err))
+	}
+	h.Bot.Send(s.reply(done))
+}
+
+func (h *Handler) listGlobalPresets(s session) {
+	entries := config.PresetEntries()
+	if len(entries) == 0 {
+		h.Bot.Send(s.reply("当前没有全局预设。"))
+		return
+	}
+	var b strings.Builder
+	b.WriteString("全局预设（file：presets.toml，db：数据库）：\n\n")
+	for i, e := range entries {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, e)
+	}
+	for _, part := range splitRunes(b.String(), MAX_MESSAGE_LENGTH) {
+		h.Bot.Send(s.reply(part))
+	}
+}
+
+// parsePresetField 校验 /gpreset edit 的字段与值，返回数据库列名与要写入的值，
+// 生成参数的值为空时写入 NULL，恢复为文件中的定义或后端默认值
+func parsePresetField(field, value string) (string, interface{}, string) {
+	switch field {
+	case "button", "content", "provider":
+		return field, value, ""
+	}
+	if value == "" {
+		switch field {
+		case "model", "temperature", "top_p", "max_tokens", "stop", "response_format", "pair":
+			return field, nil, ""
+		}
+	}
+
+	switch field {
+	case "model":
+		return field, value, ""
+	case "temperature", "top_p":
+		limit := 2.0
+		if field == "top_p" {
+			limit = 1
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil || v < 0 || v > limit {
+			return "", nil, fmt.Sprintf("%s 必须是 0 到 %g 之间的数字。", field, limit)
+		}
+		return field, v, ""
+	case "max_tokens":
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return "", nil, "max_tokens 必须是大于 0 的整数。"
+		}
+		return field, v, ""
+	case "stop":
+		var stop []string
+		for _, seq := range strings.Split(value, "|") {
+			if seq != "" {
+				stop = append(stop, seq)
+			}
+		}
+		// 通过 map 写入时不经过 serializer，需要自行编码
+		data, err := json.Marshal(stop)
+		if err != nil {
+			return "", nil, "停止序列格式错误。"
+		}
+		return field, string(data), ""
+	case "pair":
+		pair := strings.Split(strings.ToLower(strings.ReplaceAll(value, " ", "")), ",")
+		if len(pair) != 2 || pair[0] == pair[1] || !langdetect.Supported(pair[0]) || !langdetect.Supported(pair[1]) {
+			return "", nil, "pair 必须是两种不同的语言代码，用逗号分隔，例如 zh,ja。"
+		}
+		data, err := json.Marshal(pair)
+		if err != nil {
+			return "", nil, "语言对格式错误。"
+		}
+		return field, string(data), ""
+	case "response_format":
+		if value != "text" && value != llm.ResponseFormatJSON {
+			return "", nil, "response_format 只能是 text 或 json。"
+		}
+		return field, value, ""
+	}
+	return "", nil, "不支持修改该字段。\n\n" + gpresetUsage
+}
+
+func findPresetEntry(command string) (config.PresetEntry, bool) {
+	for _, e := range config.PresetEntries() {
+		if e.Command == command {
+			return e, true
+		}
+	}
+	return config.PresetEntry{}, false
+}
+
+// moveGlobalPreset 将预设移到第 position 位，并为所有预设写入新的排序位置
+func moveGlobalPreset(db *gorm.DB, command string, position int) error {
+	entries := config.PresetEntries()
+	from := -1
+	for i, e := range entries {
+		if e.Command == command {
+			from = i
+			break
+		}
+	}
+	if from < 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	order := make([]string, 0, len(entries))
+	for i, e := range entries {
+		if i != from {
+			order = append(order, e.Command)
+		}
+	}
+	to := position - 1
+	if to > len(order) {
+		to = len(order)
+	}
+	order = append(order[:to], append([]string{command}, order[to:]...)...)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for i, cmd := range order {
+			if err := models.UpsertGlobalPreset(tx, cmd, map[string]interface{}{"position": (i + 1) * 10}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tg-bot-go/langdetect"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	GLOSSARY_MAX_ENTRIES     = 500 // 每个聊天最多的术语数
+	GLOSSARY_MAX_TERM        = 64  // 术语的最大长度 (chars)
+	GLOSSARY_MAX_TRANSLATION = 128 // 译法的最大长度 (chars)
+	GLOSSARY_PROMPT_LIMIT    = 50  // 单次请求最多注入的术语数
+	GLOSSARY_CACHE_TTL       = time.Hour
+)
+
+const glossaryUsage = `用法：
+/glossary add <源语言>-<目标语言> <术语> = <译法> - 添加术语，例如 /glossary add zh-ja 星云 = ネビュラ
+/glossary list - 查看术语表
+/glossary remove <ID> - 删除术语
+/glossary import <源语言>-<目标语言>（换行后每行一条：术语 = 译法）- 批量导入
+
+语言代码：zh、ja、ko、en、ru、uk、fr、de、es、it、pt 等。
+术语只在消息中出现时才会加入提示词，回复没有使用指定译法时会提示。私聊中为个人术语表，群聊中由全群共享。`
+
+// handleGlossaryCommand 处理 /glossary add|list|remove|import
+func (h *Handler) handleGlossaryCommand(ctx context.Context, s session, args string) {
+	// 第一行为子命令与参数，import 的术语在之后的行中
+	firstLine, rest, _ := strings.Cut(args, "\n")
+	action, params, _ := strings.Cut(strings.TrimSpace(firstLine), " ")
+	params = strings.TrimSpace(params)
+
+	switch strings.ToLower(action) {
+	case "add":
+		pair, line, _ := strings.Cut(params, " ")
+		source, target, ok := parseLanguagePair(pair)
+		term, translation, lineOK := parseGlossaryLine(line)
+		if !ok || !lineOK {
+			h.Bot.Send(s.reply(glossaryUsage))
+			return
+		}
+		entry := models.GlossaryEntry{ChatID: s.ChatID, SourceLang: source, TargetLang: target, Term: term, Translation: translation}
+		if msg := h.saveGlossary(ctx, s, []models.GlossaryEntry{entry}); msg != "" {
+			h.Bot.Send(s.reply(msg))
+			return
+		}
+		h.Bot.Send(s.replyf("已添加术语：%s → %s（%s）。", term, translation, languagePairText(source, target)))
+
+	case "import":
+		source, target, ok := parseLanguagePair(params)
+		if !ok || strings.TrimSpace(rest) == "" {
+			h.Bot.Send(s.reply(glossaryUsage))
+			return
+		}
+		// 同一术语出现多次时以最后一次为准
+		index := make(map[string]int)
+		var entries []models.GlossaryEntry
+		var invalid []string
+		for _, line := range strings.Split(rest, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			term, translation, ok := parseGlossaryLine(line)
+			if !ok {
+				invalid = append(invalid, strings.TrimSpace(line))
+				continue
+			}
+			entry := models.GlossaryEntry{ChatID: s.ChatID, SourceLang: source, TargetLang: target, Term: term, Translation: translation}
+			if i, exists := index[term]; exists {
+				entries[i] = entry
+				continue
+			}
+			index[term] = len(entries)
+			entries = append(entries, entry)
+		}
+		if len(entries) == 0 {
+			h.Bot.Send(s.reply("没有可导入的术语，每行格式为：术语 = 译法。"))
+			return
+		}
+		if msg := h.saveGlossary(ctx, s, entries); msg != "" {
+			h.Bot.Send(s.reply(msg))
+			return
+		}
+		reply := s.trf("已导入 %d 条术语（%s）。", len(entries), languagePairText(source, target))
+		if len(invalid) > 0 {
+			reply += s.trf("\n以下 %d 行格式错误，已跳过：\n%s", len(invalid), truncateRunes(strings.Join(invalid, "\n"), 1000))
+		}
+		h.Bot.Send(s.reply(reply))
+
+	case "list":
+		h.listGlossary(ctx, s)
+
+	case "remove":
+		id, err := strconv.ParseUint(params, 10, 64)
+		if err != nil {
+			h.Bot.Send(s.reply("用法：/glossary remove <ID>，ID 可通过 /glossary list 查看。"))
+			return
+		}
+		if err := models.DeleteGlossaryEntry(h.DB.WithContext(ctx), s.ChatID, uint(id)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				h.Bot.Send(s.reply("术语不存在。"))
+				return
+			}
+			logger.LogRuntime(fmt.Sprintf("Failed to delete glossary entry: %v", err))
+			h.Bot.Send(s.reply("删除术语失败，请稍后再试。"))
+			return
+		}
+		h.invalidateGlossary(ctx, s.ChatID)
+		h.Bot.Send(s.reply("已删除术语。"))
+
+	default:
+		h.Bot.Send(s.reply(glossaryUsage))
+	}
+}
+
+// saveGlossary 检查数量上限后保存术语，失败时返回提示文字
+func (h *Handler) saveGlossary(ctx context.Context, s session, entries []models.GlossaryEntry) string {
+	chatID := s.ChatID
+	db := h.DB.WithContext(ctx)
+	count, err := models.CountGlossary(db, chatID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to count glossary entries: %v", err))
+		return "保存术语失败，请稍后再试。"
+	}
+	// 覆盖已有术语不占用新的名额，这里按最坏情况估算
+	if int(count)+len(entries) > GLOSSARY_MAX_ENTRIES {
+		return s.trf("术语表最多 %d 条，当前已有 %d 条。", GLOSSARY_MAX_ENTRIES, count)
+	}
+	if err := models.SaveGlossaryEntries(db, entries); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to save glossary entries: %v", err))
+		return "保存术语失败，请稍后再试。"
+	}
+	h.invalidateGlossary(ctx, chatID)
+	return ""
+}
+
+func (h *Handler) listGlossary(ctx context.Context, s session) {
+	entries, err := models.ListGlossary(h.DB.WithContext(ctx), s.ChatID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to list glossary: %v", err))
+		h.Bot.Send(s.reply("获取术语表失败，请稍后再试。"))
+		return
+	}
+	if len(entries) == 0 {
+		h.Bot.Send(s.reply("术语表为空，发送 /glossary 查看用法。"))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(s.trf("术语表（共 %d 条）：\n", len(entries)))
+	lastPair := ""
+	for _, e := range entries {
+		if pair := languagePairText(e.SourceLang, e.TargetLang); pair != lastPair {
+			fmt.Fprintf(&b, "\n%s\n", pair)
+			lastPair = pair
+		}
+		fmt.Fprintf(&b, "#%d %s → %s\n", e.ID, e.Term, e.Translation)
+	}
+	for _, part := range splitRunes(b.String(), MAX_MESSAGE_LENGTH) {
+		h.Bot.Send(s.reply(part))
+	}
+}
+
+// loadGlossary 读取聊天的术语表，优先使用 Redis 缓存；出错时返回空术语表
+func (h *Handler) loadGlossary(ctx context.Context, chatID int64) []models.GlossaryEntry {
+	key := h.Keys.glossary(chatID)
+	if cached, err := h.Redis.Get(ctx, key).Bytes(); err == nil {
+		var entries []models.GlossaryEntry
+		if err := json.Unmarshal(cached, &entries); err == nil {
+			return entries
+		}
+	}
+
+	entries, err := models.ListGlossary(h.DB.WithContext(ctx), chatID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to load glossary for chat %d: %v", chatID, err))
+		return nil
+	}
+	if data, err := json.Marshal(entries); err == nil {
+		if err := h.Redis.Set(ctx, key, data, GLOSSARY_CACHE_TTL).Err(); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to cache glossary: %v", err))
+		}
+	}
+	return entries
+}
+
+func (h *Handler) invalidateGlossary(ctx context.Context, chatID int64) {
+	if err := h.Redis.Del(ctx, h.Keys.glossary(chatID)).Err(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to invalidate glossary cache: %v", err))
+	}
+}
+
+// matchGlossary 返回输入中出现、且语言对与本次翻译相符的术语；语言无法确定时不按该项过滤
+func (h *Handler) matchGlossary(ctx context.Context, chatID int64, text, source, target string) []models.GlossaryEntry {
+	if text == "" {
+		return nil
+	}
+	var matches []models.GlossaryEntry
+	for _, e := range h.loadGlossary(ctx, chatID) {
+		if (source != "" && e.SourceLang != source) || (target != "" && e.TargetLang != target) {
+			continue
+		}
+		if containsTerm(text, e.Term) {
+			matches = append(matches, e)
+			if len(matches) == GLOSSARY_PROMPT_LIMIT {
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// glossaryPrompt 追加到 System Prompt 的术语要求
+func glossaryPrompt(matches []models.GlossaryEntry) string {
+	if len(matches) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n翻译时必须使用以下术语译法：")
+	for _, e := range matches {
+		fmt.Fprintf(&b, "\n- %s → %s（译为%s时）", e.Term, e.Translation, langdetect.Name(e.TargetLang))
+	}
+	return b.String()
+}
+
+// glossaryWarning 检查回复是否使用了术语的指定译法，返回追加在回复后的提示，没有问题时为空。
+// 同一术语有多个目标语言的译法时，回复中出现其中任何一个即可
+func glossaryWarning(lang string, matches []models.GlossaryEntry, reply string) string {
+	if len(matches) == 0 {
+		return ""
+	}
+	satisfied := make(map[string]bool)
+	var terms []string
+	expected := make(map[string][]string)
+	for _, e := range matches {
+		if _, seen := expected[e.Term]; !seen {
+			terms = append(terms, e.Term)
+		}
+		expected[e.Term] = append(expected[e.Term], e.Translation)
+		if containsTerm(reply, e.Translation) {
+			satisfied[e.Term] = true
+		}
+	}
+
+	var violations []string
+	for _, term := range terms {
+		if !satisfied[term] {
+			violations = append(violations, fmt.Sprintf("%s → %s", term, strings.Join(expected[term], " / ")))
+		}
+	}
+	if len(violations) == 0 {
+		return ""
+	}
+	return tr(lang, "\n\n⚠️ 译文未使用术语表中的译法：") + strings.Join(violations, tr(lang, "；"))
+}
+
+// containsTerm 不区分大小写地查找术语；以字母或数字开头、结尾的拉丁文术语要求整词匹配，避免 AI 匹配到 said
+func containsTerm(text, term string) bool {
+	text, term = strings.ToLower(text), strings.ToLower(term)
+	if term == "" {
+		return false
+	}
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], term)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(term)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		first, _ := utf8.DecodeRuneInString(term)
+		last, _ := utf8.DecodeLastRuneInString(term)
+		if !(isWordRune(first) && isWordRune(before)) && !(isWordRune(last) && isWordRune(after)) {
+			return true
+		}
+		offset = start + utf8.RuneLen(first)
+	}
+}
+
+// isWordRune 拉丁文等以空格分词的文字中的字母或数字，中日韩文字不分词
+func isWordRune(r rune) bool {
+	if r == utf8.RuneError || unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Thai) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parseLanguagePair 解析 zh-ja 形式的语言对
+func parseLanguagePair(pair string) (source, target string, ok bool) {
+	source, target, found := strings.Cut(strings.ToLower(strings.TrimSpace(pair)), "-")
+	if !found || source == target || !langdetect.Supported(source) || !langdetect.Supported(target) {
+		return "", "", false
+	}
+	return source, target, true
+}
+
+// parseGlossaryLine 解析 “术语 = 译法”，也接受制表符分隔
+func parseGlossaryLine(line string) (term, translation string, ok bool) {
+	term, translation, found := strings.Cut(line, "=")
+	if !found {
+		term, translation, found = strings.Cut(line, "\t")
+	}
+	term, translation = strings.TrimSpace(term), strings.TrimSpace(translation)
+	if !found || term == "" || translation == "" ||
+		utf8.RuneCountInString(term) > GLOSSARY_MAX_TERM || utf8.RuneCountInString(translation) > GLOSSARY_MAX_TRANSLATION {
+		return "", "", false
+	}
+	return term, translation, true
+}
+
+func languagePairText(source, target string) string {
+	return fmt.Sprintf("%s → %s", langdetect.Name(source), langdetect.Name(target))
+}
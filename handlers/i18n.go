@@ -0,0 +1,199 @@
+package handlers
+
+import "fmt"
+
+// UI_LANGUAGE_EN 英文界面，其余 (包括未设置) 使用中文
+const UI_LANGUAGE_EN = "en"
+
+// enMessages 回复文字的英文译文，以中文原文 (带格式的文字以格式串) 为键；
+// 管理员命令与发给大模型的提示词不在其中，始终使用中文
+var enMessages = map[string]string{
+	// 通用
+	"系统错误，请稍后再试。":         "System error, please try again later.",
+	"您的使用权限已过期或未获得授权。":    "Your access has expired or you are not authorized.",
+	"您发送消息太快了，请稍后再试。":     "You are sending messages too fast, please try again later.",
+	"还在处理您的上一条消息，请稍候再发送。": "Still working on your previous message, please wait before sending another.",
+	"还在处理您的上一条消息，请稍候。":    "Still working on your previous message, please wait.",
+	"您没有管理员权限。":           "You do not have admin permission.",
+
+	// /start、/help、/about、/clear、/id、/expiry
+	"欢迎使用tg-bot-go！请选择一个选项：": "Welcome to tg-bot-go! Please choose an option:",
+	"这里是帮助信息...":             "Here is the help information...",
+	"关于我们...":                "About us...",
+	"帮助":                     "Help",
+	"关于":                     "About",
+	"清空上下文失败，请稍后再试。":       "Failed to clear the context, please try again later.",
+	"已清空所有对话上下文和预设。":       "Cleared all conversation context and the preset.",
+	"您的用户ID是：%d":           "Your user ID is: %d",
+	"\n当前群组ID是：%d":         "\nThis group's ID is: %d",
+	"您还不是白名单用户。":           "You are not on the whitelist yet.",
+	"您是管理员用户，永久有效。":        "You are an admin, your access never expires.",
+	"您的使用权限已过期。":           "Your access has expired.",
+	"您的使用权限还剩 %d 天 %d 小时。": "Your access expires in %d days %d hours.",
+
+	// 预设
+	"设置预设失败，请稍后再试。":    "Failed to set the preset, please try again later.",
+	"已切换到%s，您可以开始对话了。": "Switched to %s, you can start chatting now.",
+
+	// 中止与流式回复
+	"已取消编辑预设。":                    "Preset editing cancelled.",
+	"已停止。":                        "Stopped.",
+	"当前没有正在进行的任务。":                "There is no task in progress.",
+	"当前没有您正在进行的任务。":               "You have no task in progress.",
+	"⏹ 停止":                        "⏹ Stop",
+	"处理超时，请缩短内容后再试。":              "Timed out, please shorten the content and try again.",
+	"服务正在重启，请稍后再试。":               "The service is restarting, please try again later.",
+	"思考中…":                        "Thinking…",
+	"回复较长，完整内容见文件。":               "The reply is long, see the file for the full text.",
+	"\n\n（已停止）":                   "\n\n(stopped)",
+	"获取响应失败，请稍后再试。":               "Failed to get a response, please try again later.",
+	"当前模型不支持图片输入。":                "The current model does not support image input.",
+	"用法：/tr <文本>，或回复一条消息并发送 /tr。": "Usage: /tr <text>, or reply to a message with /tr.",
+
+	// 图片与语音
+	"下载图片失败，请稍后再试。": "Failed to download the image, please try again later.",
+	"暂不支持语音消息。":     "Voice messages are not supported yet.",
+	"下载语音失败，请稍后再试。": "Failed to download the voice message, please try again later.",
+	"语音识别失败，请稍后再试。": "Speech recognition failed, please try again later.",
+	"未能识别语音内容。":     "Could not recognize any speech.",
+	"🎙 识别结果：\n%s":   "🎙 Transcript:\n%s",
+
+	// 文件与字幕
+	"暂不支持该文件格式，目前支持 .txt、.md、.docx 以及 .srt、.vtt 字幕。": "Unsupported file format. Supported: .txt, .md, .docx and .srt, .vtt subtitles.",
+	"请先通过 /start 选择一个翻译模式，再发送文件。":                    "Please choose a translation mode with /start before sending a file.",
+	"下载文件失败，请稍后再试。":                                  "Failed to download the file, please try again later.",
+	"无法解析该 .docx 文件。":                                "Could not parse this .docx file.",
+	"文件不是 UTF-8 编码，请转换后再发送。":                         "The file is not UTF-8 encoded, please convert it and send it again.",
+	"文件中没有可翻译的内容。":                                   "The file has nothing to translate.",
+	"文件过大，请拆分后再发送。":                                  "The file is too large, please split it and send it again.",
+	"正在翻译 %s":               "Translating %s",
+	"翻译文件失败，请稍后再试。":         "Failed to translate the file, please try again later.",
+	"生成译文文件失败。":             "Failed to generate the translated file.",
+	"%s 翻译完成。":              "%s translated.",
+	"无法解析该字幕文件，请检查格式。":      "Could not parse this subtitle file, please check its format.",
+	"字幕文件中没有可翻译的内容。":        "The subtitle file has nothing to translate.",
+	"字幕文件过大，请拆分后再发送。":       "The subtitle file is too large, please split it and send it again.",
+	"正在翻译字幕 %s（%d 条）":       "Translating subtitles %s (%d cues)",
+	"正在翻译字幕 %s（%d 条，%s）":    "Translating subtitles %s (%d cues, %s)",
+	"翻译字幕失败，请稍后再试。":         "Failed to translate the subtitles, please try again later.",
+	"翻译后的字幕条数与原文不一致，请稍后再试。": "The translated subtitles do not match the original cue count, please try again later.",
+	"%s 翻译完成，共 %d 条字幕。":     "%s translated, %d cues.",
+
+	// 多语言同时翻译
+	"目标语言最多 %d 个字符。":                          "The target language can be at most %d characters.",
+	"请设置 %d 到 %d 个不同的目标语言，用逗号分隔，例如 en,ja,ru。": "Please set %d to %d different target languages separated by commas, e.g. en,ja,ru.",
+	"翻译失败，请稍后再试。":                             "Translation failed, please try again later.",
+	"（翻译失败）":                                  "(translation failed)",
+	"翻译中…":                                    "Translating…",
+	"\n\n⚠️ 译文未使用术语表中的译法：":                    "\n\n⚠️ The translation did not use the glossary terms: ",
+	"；":             "; ",
+	"、":             ", ",
+	MEMORY_HIT_MARK: "♻️ From translation memory",
+
+	// /settings 与 /set
+	"默认":                     "default",
+	"默认对话":                   "Default chat",
+	"当前设置：\n":                "Current settings:\n",
+	"预设 (preset)：%s\n":       "Preset (preset): %s\n",
+	"目标语言 (target)：%s\n":     "Target language (target): %s\n",
+	"多语言同时翻译 (targets)：%s\n": "Multi-language translation (targets): %s\n",
+	"模型 (model)：%s\n":        "Model (model): %s\n",
+	"语气 (formality)：%s\n":    "Tone (formality): %s\n",
+	"界面语言 (lang)：%s\n":       "Interface language (lang): %s\n",
+	"\n使用 /set <项目> <值> 修改，值为 %s 时恢复默认。\n": "\nUse /set <item> <value> to change a setting, %s restores the default.\n",
+	"可用模型：%s\n": "Available models: %s\n",
+	"语气：formal、informal；界面语言：zh、en": "Tone: formal, informal; interface language: zh, en",
+	"\n群聊中的设置对所有成员生效。":              "\nSettings in a group apply to all members.",
+	"用法：/set <项目> <值>，项目可以是 preset、target、targets、model、formality、lang；发送 /settings 查看当前设置。": "Usage: /set <item> <value>, item is one of preset, target, targets, model, formality, lang; send /settings to see the current settings.",
+	"没有这个预设，发送 /start 查看可用的预设。":                                                              "No such preset, send /start to see the available presets.",
+	"未配置该后端，可用：%s（可写成 后端:模型）。":                                                               "This backend is not configured. Available: %s (you can write backend:model).",
+	"语气只能是 formal 或 informal。":                                                               "Tone must be formal or informal.",
+	"界面语言只能是 zh 或 en。":                                                                       "Interface language must be zh or en.",
+	"未知的设置项，可以是 preset、target、targets、model、formality、lang。":                                 "Unknown setting, use one of preset, target, targets, model, formality, lang.",
+	"保存设置失败，请稍后再试。":                                                                          "Failed to save the settings, please try again later.",
+	"设置已保存。": "Settings saved.",
+
+	// /glossary
+	glossaryUsage: `Usage:
+/glossary add <source>-<target> <term> = <translation> - add a term, e.g. /glossary add zh-ja 星云 = ネビュラ
+/glossary list - show the glossary
+/glossary remove <ID> - remove a term
+/glossary import <source>-<target> (then one "term = translation" per line) - import in bulk
+
+Language codes: zh, ja, ko, en, ru, uk, fr, de, es, it, pt, etc.
+A term is only added to the prompt when it appears in the message, and you are warned when the reply does not use it. The glossary is personal in private chats and shared by the whole group in groups.`,
+	"已添加术语：%s → %s（%s）。":                                 "Added term: %s → %s (%s).",
+	"没有可导入的术语，每行格式为：术语 = 译法。":                            "Nothing to import, each line should be: term = translation.",
+	"已导入 %d 条术语（%s）。":                                    "Imported %d terms (%s).",
+	"\n以下 %d 行格式错误，已跳过：\n%s":                             "\nSkipped %d malformed lines:\n%s",
+	"用法：/glossary remove <ID>，ID 可通过 /glossary list 查看。": "Usage: /glossary remove <ID>, see the IDs with /glossary list.",
+	"术语不存在。":                   "No such term.",
+	"删除术语失败，请稍后再试。":            "Failed to remove the term, please try again later.",
+	"已删除术语。":                   "Term removed.",
+	"保存术语失败，请稍后再试。":            "Failed to save the terms, please try again later.",
+	"术语表最多 %d 条，当前已有 %d 条。":    "The glossary holds at most %d terms, it already has %d.",
+	"获取术语表失败，请稍后再试。":           "Failed to load the glossary, please try again later.",
+	"术语表为空，发送 /glossary 查看用法。": "The glossary is empty, send /glossary for usage.",
+	"术语表（共 %d 条）：\n":           "Glossary (%d terms):\n",
+
+	// 用户预设
+	"最多只能保存 %d 个预设，请先通过 /mypresets 删除不用的预设。":  "You can save at most %d presets, please delete unused ones with /mypresets first.",
+	"请发送预设名称（最多 %d 个字），发送 /cancel 取消。":        "Please send the preset name (at most %d characters), or /cancel to cancel.",
+	"请发送文字内容，或发送 /cancel 取消。":                 "Please send text, or /cancel to cancel.",
+	"名称最多 %d 个字，请重新发送。":                       "The name can be at most %d characters, please send it again.",
+	"请发送预设的提示词（System Prompt，最多 %d 个字）。":      "Please send the preset prompt (system prompt, at most %d characters).",
+	"发送 %s 保持不变。":                             " Send %s to keep it unchanged.",
+	"提示词最多 %d 个字，请精简后重新发送。":                   "The prompt can be at most %d characters, please shorten it and send it again.",
+	"保存预设失败，请稍后再试。":                           "Failed to save the preset, please try again later.",
+	"预设「%s」已创建，发送 /start 即可选用，/mypresets 管理。": "Preset \"%s\" created. Send /start to use it, /mypresets to manage it.",
+	"预设「%s」已更新。":                              "Preset \"%s\" updated.",
+	"预设不存在。":                                  "No such preset.",
+	"获取预设列表失败，请稍后再试。":                         "Failed to load your presets, please try again later.",
+	"您还没有自定义预设，发送 /newpreset 创建一个。":           "You have no custom presets yet, send /newpreset to create one.",
+	"我的预设：\n\n":                               "My presets:\n\n",
+	"使用 #%d":                                  "Use #%d",
+	"编辑":                                      "Edit",
+	"分享":                                      "Share",
+	"删除":                                      "Delete",
+	"发送 /newpreset 创建新预设，/importpreset <分享码> 导入他人分享的预设。": "Send /newpreset to create a preset, /importpreset <code> to import a shared one.",
+	"正在编辑「%s」。请发送新的名称，发送 %s 保持不变，发送 /cancel 取消。":         "Editing \"%s\". Send a new name, %s to keep it unchanged, or /cancel to cancel.",
+	"删除预设失败，预设不存在或不属于您。":                                 "Failed to delete the preset, it does not exist or is not yours.",
+	"预设已删除。":                                    "Preset deleted.",
+	"该预设已被管理员禁用。":                               "This preset has been disabled by an admin.",
+	"该预设已被管理员禁用，无法分享。":                          "This preset has been disabled by an admin and cannot be shared.",
+	"分享码：%s\n其他用户发送 /importpreset %s 即可导入。":     "Share code: %s\nOther users can import it with /importpreset %s.",
+	"该预设正在等待管理员审核。":                             "This preset is waiting for admin review.",
+	"申请分享失败，请稍后再试。":                             "Failed to request sharing, please try again later.",
+	"已提交审核。审核通过后，其他用户发送 /importpreset %s 即可导入。": "Submitted for review. Once approved, other users can import it with /importpreset %s.",
+	"用法：/importpreset <分享码>":                    "Usage: /importpreset <code>",
+	"分享码无效或预设尚未通过审核。":                           "Invalid share code, or the preset has not been approved yet.",
+	"导入预设失败，请稍后再试。":                             "Failed to import the preset, please try again later.",
+	"已导入预设「%s」，发送 /start 即可选用。":                 "Imported preset \"%s\", send /start to use it.",
+	"您的预设「%s」已通过审核，分享码：%s":                      "Your preset \"%s\" was approved, share code: %s",
+	"您的预设「%s」的分享申请未通过审核，您仍可以自己使用。":              "Sharing your preset \"%s\" was not approved, you can still use it yourself.",
+	"您的预设「%s」已被管理员禁用。":                          "Your preset \"%s\" has been disabled by an admin.",
+	"待审核":   "pending review",
+	"已分享":   "shared",
+	"分享未通过": "sharing rejected",
+	"已禁用":   "disabled",
+	"仅自己可用": "private",
+
+	// 内联查询
+	"您的使用权限已过期或未获得授权": "Your access has expired or you are not authorized",
+	"请求过于频繁，请稍后再试":    "Too many requests, please try again later",
+}
+
+// tr 将回复文字翻译为界面语言，没有对应译文时返回中文原文
+func tr(lang, text string) string {
+	if lang == UI_LANGUAGE_EN {
+		if translated, ok := enMessages[text]; ok {
+			return translated
+		}
+	}
+	return text
+}
+
+// trf 翻译格式串后再格式化
+func trf(lang, format string, args ...any) string {
+	return fmt.Sprintf(tr(lang, format), args...)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// adminOnly 只有管理员会看到回复的函数，回复始终使用中文
+var adminOnly = map[string]bool{
+	"handleAdminCommand":        true,
+	"handleGlobalPresetCommand": true,
+	"listGlobalPresets":         true,
+	"handleMemoryCommand":       true,
+	"handlePresetAdminCommand":  true,
+}
+
+// TestRepliesHaveEnglish 检查传给 reply、tr 等的中文文字都有英文译文，新增回复时不会漏掉
+func TestRepliesHaveEnglish(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || adminOnly[fn.Name.Name] {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if text, ok := translatedLiteral(call); ok && hasHan(text) {
+					if _, found := enMessages[text]; !found {
+						t.Errorf("%s: %q has no English translation", fset.Position(call.Pos()), text)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// translatedLiteral 返回调用中会按界面语言翻译的字符串字面量
+func translatedLiteral(call *ast.CallExpr) (string, bool) {
+	arg := -1
+	switch fun := call.Fun.(type) {
+	case *ast.SelectorExpr:
+		switch fun.Sel.Name {
+		case "reply", "replyf", "tr", "trf", "Fail", "Finish":
+			arg = 0
+		}
+	case *ast.Ident:
+		switch fun.Name {
+		case "tr", "trf", "failureText":
+			arg = 1
+		}
+	}
+	if arg < 0 || len(call.Args) <= arg {
+		return "", false
+	}
+	lit, ok := call.Args[arg].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	text, err := strconv.Unquote(lit.Value)
+	return text, err == nil
+}
+
+func hasHan(s string) bool {
+	for _, r := range s {
+		if r >= 0x4e00 && r <= 0x9fff {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTr(t *testing.T) {
+	if got := tr("en", "已停止。"); got != "Stopped." {
+		t.Fatalf("tr(en) = %q", got)
+	}
+	if got := tr("", "已停止。"); got != "已停止。" {
+		t.Fatalf("default language should keep the Chinese text, got %q", got)
+	}
+	if got := tr("en", "没有译文的文字"); got != "没有译文的文字" {
+		t.Fatalf("missing entries should fall back to Chinese, got %q", got)
+	}
+	if got := trf("en", "已切换到%s，您可以开始对话了。", "Chat"); got != "Switched to Chat, you can start chatting now." {
+		t.Fatalf("trf(en) = %q", got)
+	}
+}
@@ -3,32 +3,80 @@ package handlers
 import (
 	"context"
 	"log"
+	"sync"
+	"tg-bot-go/llm"
+	"tg-bot-go/tokenizer"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"gorm.io/gorm"
 )
 
-var (
-	ctx = context.Background()
-)
-
 // Handler 结构体用于依赖注入
 type Handler struct {
 	Bot   *tgbotapi.BotAPI
 	DB    *gorm.DB
 	Redis *redis.Client
+	LLM   *llm.Registry
+	Keys  Keys
+
+	// Transcriber 语音转写后端，为 nil 时不处理语音消息
+	Transcriber llm.Transcriber
+
+	// TrigramSearch 数据库是否启用了 pg_trgm，否则翻译记忆在程序中计算相似度
+	TrigramSearch bool
+
+	// Tokens 上下文预算的 token 计数，零值按字符估算
+	Tokens *tokenizer.Counter
+
+	generations generations
+	inlineSlots chan struct{} // 内联查询的大模型调用并发名额
+
+	// 不属于任何请求的后台任务 (对话摘要)，退出时等待或取消
+	background       sync.WaitGroup
+	backgroundCtx    context.Context
+	cancelBackground context.CancelFunc
 }
 
 // NewHandler 创建新的处理程序实例
-func NewHandler(bot *tgbotapi.BotAPI, db *gorm.DB, rdb *redis.Client) *Handler {
+func NewHandler(bot *tgbotapi.BotAPI, db *gorm.DB, rdb *redis.Client, providers *llm.Registry) *Handler {
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
 	return &Handler{
 		Bot:   bot,
 		DB:    db,
 		Redis: rdb,
+		LLM:   providers,
+		Keys:  NewKeys(DEFAULT_KEY_PREFIX),
+
+		Tokens: &tokenizer.Counter{},
+
+		inlineSlots: make(chan struct{}, INLINE_CONCURRENCY),
+
+		backgroundCtx:    backgroundCtx,
+		cancelBackground: cancelBackground,
 	}
 }
 
+// Wait 等待后台任务完成
+func (h *Handler) Wait() {
+	h.background.Wait()
+}
+
+// CancelBackground 取消仍在进行的后台任务，用于退出时等待超时的情况
+func (h *Handler) CancelBackground() {
+	h.cancelBackground()
+}
+
+// goBackground 在后台运行任务，退出时会等待其完成
+func (h *Handler) goBackground(task func(ctx context.Context)) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		task(h.backgroundCtx)
+	}()
+}
+
 // InitRedis 初始化 Redis 客户端
 func InitRedis(redisAddr string) *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
@@ -36,12 +84,12 @@ func InitRedis(redisAddr string) *redis.Client {
 	})
 
 	// 测试连接
-	if _, err := rdb.Ping(ctx).Result(); err != nil {
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
 		log.Printf("Warning: Redis connection failed: %v", err)
 	}
 	return rdb
 }
 
 const (
-	MAX_CONTEXT_LENGTH = 3000 // 最大上下文长度 (chars)
-)
\ No newline at end of file
+	CONTEXT_TTL = 30 * time.Minute // 对话上下文与摘要在最后一条消息后保留的时间
+)
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	INLINE_DEBOUNCE    = 700 * time.Millisecond // 用户停止输入多久后才开始翻译
+	INLINE_TIMEOUT     = 8 * time.Second        // 内联查询需要尽快应答，超时的预设直接跳过
+	INLINE_CACHE_TTL   = 24 * time.Hour         // 翻译结果在 Redis 中的缓存时间
+	INLINE_CACHE_TIME  = 300                    // Telegram 侧的结果缓存时间 (seconds)
+	INLINE_CONCURRENCY = 4                      // 所有内联查询合计同时进行的大模型调用数
+)
+
+// HandleInlineQuery 处理 @bot <文本> 内联查询，为每个翻译预设返回一条结果
+func (h *Handler) HandleInlineQuery(ctx context.Context, update tgbotapi.Update) {
+	query := update.InlineQuery
+	userID := query.From.ID
+	text := strings.TrimSpace(query.Query)
+	if text == "" {
+		return
+	}
+
+	// 与私聊消息相同的白名单与有效期规则
+	isValid, err := models.IsUserValid(h.DB.WithContext(ctx), userID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("检查用户有效性失败：%v", err))
+		return
+	}
+	// 内联查询没有所在聊天，按用户私聊的界面语言提示
+	lang := h.loadSettings(ctx, userID).UILanguage
+	if !isValid {
+		h.answerInline(tgbotapi.InlineConfig{
+			InlineQueryID:     query.ID,
+			IsPersonal:        true,
+			SwitchPMText:      tr(lang, "您的使用权限已过期或未获得授权"),
+			SwitchPMParameter: "unauthorized",
+		})
+		return
+	}
+
+	// 防抖由调度器完成，这里只会收到用户停止输入后的查询；与私聊消息共用限流
+	if h.isRateLimited(ctx, userID) {
+		h.answerInline(tgbotapi.InlineConfig{
+			InlineQueryID:     query.ID,
+			IsPersonal:        true,
+			SwitchPMText:      tr(lang, "请求过于频繁，请稍后再试"),
+			SwitchPMParameter: "ratelimited",
+		})
+		return
+	}
+
+	var presets []config.PresetItem
+	for _, item := range config.Presets() {
+		if item.Content != "" {
+			presets = append(presets, item)
+		}
+	}
+
+	translateCtx, cancel := context.WithTimeout(ctx, INLINE_TIMEOUT)
+	defer cancel()
+
+	translations := make([]string, len(presets))
+	runParallel(translateCtx, len(presets), INLINE_CONCURRENCY, func(ctx context.Context, i int) error {
+		translations[i] = h.inlineTranslate(ctx, presets[i], text)
+		return nil
+	}, nil)
+
+	var results []interface{}
+	for i, item := range presets {
+		if translations[i] == "" {
+			continue
+		}
+		title := item.Button
+		if _, direction := presetPrompt(item, models.UserSettings{}, text); direction != "" {
+			title += fmt.Sprintf("（%s）", direction)
+		}
+		article := tgbotapi.NewInlineQueryResultArticle(inlineResultID(item.Command), title, translations[i])
+		article.Description = truncateRunes(translations[i], 100)
+		results = append(results, article)
+	}
+
+	logger.LogUserMessage(userID, fmt.Sprintf("[内联] %s (%d 条结果)", text, len(results)))
+	h.answerInline(tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     INLINE_CACHE_TIME,
+		IsPersonal:    true,
+	})
+}
+
+// inlineTranslate 使用预设翻译文本，优先读取 Redis 缓存，失败时返回空字符串
+func (h *Handler) inlineTranslate(ctx context.Context, preset config.PresetItem, text string) string {
+	cacheKey := h.Keys.inlineCache(preset.Command, presetFingerprint(preset), text)
+	if cached, err := h.Redis.Get(ctx, cacheKey).Result(); err == nil && cached != "" {
+		return cached
+	}
+
+	// 内联查询的大模型调用受全局并发限制，排队超时的预设直接跳过
+	select {
+	case h.inlineSlots <- struct{}{}:
+		defer func() { <-h.inlineSlots }()
+	case <-ctx.Done():
+		return ""
+	}
+
+	provider := llm.WithDefaults(h.LLM.Get(preset.Provider), preset.Model, generationParams(preset))
+	prompt, _ := presetPrompt(preset, models.UserSettings{}, text)
+	response, err := provider.Chat(ctx, &llm.Request{Messages: []llm.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: text},
+	}})
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Inline translation error (%s, %s): %v", provider.Name(), preset.Command, err))
+		return ""
+	}
+	response = strings.TrimSpace(response)
+
+	if err := h.Redis.Set(ctx, cacheKey, response, INLINE_CACHE_TTL).Err(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to cache inline translation: %v", err))
+	}
+	return response
+}
+
+func (h *Handler) answerInline(answer tgbotapi.InlineConfig) {
+	if _, err := h.Bot.Request(answer); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Error answering inline query: %v", err))
+	}
+}
+
+// inlineResultID 结果 ID 最长 64 字节
+func inlineResultID(command string) string {
+	id := strings.TrimPrefix(command, "/")
+	if len(id) > 64 {
+		id = id[:64]
+	}
+	return id
+}
+
+// presetFingerprint 预设内容、后端、模型与生成参数的摘要，预设热加载或修改后不会命中旧的缓存
+func presetFingerprint(preset config.PresetItem) string {
+	data, _ := json.Marshal(preset)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
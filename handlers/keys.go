@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"tg-bot-go/logger"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// KEY_SCHEMA_VERSION Redis 键布局的版本，键的格式或内容不兼容时递增，旧版本的键会在启动时清理
+	KEY_SCHEMA_VERSION = 1
+	DEFAULT_KEY_PREFIX = "tgbot"
+
+	keyScanCount = 500 // 每次 SCAN 返回的键数量提示
+)
+
+// Keys 生成带前缀与版本号的 Redis 键，格式为 <prefix>:v<version>:<name>，
+// 多个实例或应用共享同一个 Redis 数据库时互不影响
+type Keys struct {
+	Prefix string
+}
+
+// NewKeys 创建键命名空间，prefix 为空时使用 DEFAULT_KEY_PREFIX
+func NewKeys(prefix string) Keys {
+	if prefix == "" {
+		prefix = DEFAULT_KEY_PREFIX
+	}
+	return Keys{Prefix: prefix}
+}
+
+func (k Keys) namespace(version int) string {
+	return fmt.Sprintf("%s:v%d:", k.Prefix, version)
+}
+
+func (k Keys) key(format string, args ...interface{}) string {
+	return k.namespace(KEY_SCHEMA_VERSION) + fmt.Sprintf(format, args...)
+}
+
+// settings 聊天设置 (含预设) 的缓存，群内成员共享同一份设置
+func (k Keys) settings(chatID int64) string {
+	return k.key("chat:%d:settings", chatID)
+}
+
+// glossary 聊天术语表的缓存
+func (k Keys) glossary(chatID int64) string {
+	return k.key("chat:%d:glossary", chatID)
+}
+
+// context 上下文按聊天内的用户保存，群内成员互不干扰
+func (k Keys) context(chatID, userID int64) string {
+	return k.key("chat:%d:user:%d:context", chatID, userID)
+}
+
+// summary 被压缩的早期对话的摘要，与上下文一同过期
+func (k Keys) summary(chatID, userID int64) string {
+	return k.key("chat:%d:user:%d:summary", chatID, userID)
+}
+
+// summaryLock 保证同一上下文同时只有一个摘要任务
+func (k Keys) summaryLock(chatID, userID int64) string {
+	return k.key("chat:%d:user:%d:summary_lock", chatID, userID)
+}
+
+func (k Keys) rateLimit(userID int64) string {
+	return k.key("ratelimit:%d", userID)
+}
+
+// presetDraft 创建或编辑预设的向导状态
+func (k Keys) presetDraft(chatID, userID int64) string {
+	return k.key("chat:%d:user:%d:preset_draft", chatID, userID)
+}
+
+// inlineCache 内联翻译结果缓存，按预设 (含内容与模型的摘要) 与查询文本区分
+func (k Keys) inlineCache(command, fingerprint, query string) string {
+	sum := sha256.Sum256([]byte(command + "\x00" + fingerprint + "\x00" + query))
+	return k.key("inline:cache:%s", hex.EncodeToString(sum[:]))
+}
+
+// 加入命名空间之前写入的键，只匹配本机器人使用过的格式：
+// 旧版按聊天保存上下文与预设提示词 (user:<chat_id>:context / user:<chat_id>:preset)。
+// 旧版限流计数器 (ratelimit:<user_id>) 一分钟内自行过期，不做处理
+var (
+	legacyContextKey = regexp.MustCompile(`^user:(-?\d+):context$`)
+	legacyPresetKey  = regexp.MustCompile(`^user:-?\d+:preset$`)
+)
+
+// MigrateKeys 启动时整理 Redis 中的键，代替清空整个数据库：
+// 同一前缀下其他版本的键被删除；无前缀的旧版私聊上下文迁移到当前命名空间 (保留过期时间)，
+// 群聊上下文无法区分成员，与旧版预设提示词 (预设已改存数据库) 一起删除。不匹配上述格式的键不受影响
+func MigrateKeys(ctx context.Context, rdb *redis.Client, keys Keys) error {
+	current := keys.namespace(KEY_SCHEMA_VERSION)
+	removed, migrated := 0, 0
+
+	// 同一前缀下的其他版本
+	err := scanKeys(ctx, rdb, keys.Prefix+":v*", func(key string) error {
+		if strings.HasPrefix(key, current) {
+			return nil
+		}
+		removed++
+		return rdb.Unlink(ctx, key).Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	// 无前缀的旧版键
+	err = scanKeys(ctx, rdb, "user:*", func(key string) error {
+		if m := legacyContextKey.FindStringSubmatch(key); m != nil {
+			chatID, _ := strconv.ParseInt(m[1], 10, 64)
+			// 私聊的 chat_id 即用户 ID；目标键已存在时保留新数据
+			if chatID > 0 {
+				ok, err := rdb.RenameNX(ctx, key, keys.context(chatID, chatID)).Result()
+				if err != nil {
+					return err
+				}
+				if ok {
+					migrated++
+					return nil
+				}
+			}
+			removed++
+			return rdb.Unlink(ctx, key).Err()
+		}
+		if legacyPresetKey.MatchString(key) {
+			removed++
+			return rdb.Unlink(ctx, key).Err()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.LogRuntime(fmt.Sprintf("Redis keys migrated to %s*: %d moved, %d stale removed", current, migrated, removed))
+	return nil
+}
+
+// scanKeys 以 SCAN 遍历匹配的键，避免 KEYS 阻塞 Redis
+func scanKeys(ctx context.Context, rdb *redis.Client, match string, fn func(key string) error) error {
+	iter := rdb.Scan(ctx, 0, match, keyScanCount).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(iter.Val()); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
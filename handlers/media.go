@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	MAX_DOWNLOAD_SIZE    = 20 * 1024 * 1024 // Bot API 允许下载的最大文件大小 (bytes)
+	DEFAULT_IMAGE_PROMPT = "请识别图片中的文字，并按照当前模式处理。"
+)
+
+var downloadClient = &http.Client{
+	Timeout: 60 * time.Second,
+}
+
+// handlePhoto 下载图片并作为多模态内容发送给视觉模型
+func (h *Handler) handlePhoto(ctx context.Context, s session, message *tgbotapi.Message) {
+	var fileID, mimeType string
+	if len(message.Photo) > 0 {
+		// Photo 按尺寸从小到大排列，取最大的一张
+		photo := message.Photo[len(message.Photo)-1]
+		fileID, mimeType = photo.FileID, "image/jpeg"
+	} else {
+		fileID, mimeType = message.Document.FileID, message.Document.MimeType
+	}
+
+	data, err := h.downloadFile(ctx, fileID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to download photo: %v", err))
+		h.Bot.Send(s.reply("下载图片失败，请稍后再试。"))
+		return
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		mimeType = http.DetectContentType(data)
+	}
+
+	prompt := h.stripMention(message.Caption)
+	logger.LogUserMessage(s.UserID, "[图片] "+prompt)
+	if prompt == "" {
+		prompt = DEFAULT_IMAGE_PROMPT
+	}
+
+	h.chat(ctx, s, llm.Message{
+		Role:    "user",
+		Content: prompt,
+		Images:  []llm.Image{{MIMEType: mimeType, Data: data}},
+	})
+}
+
+// handleVoice 转写语音消息，展示识别结果后按当前预设处理
+func (h *Handler) handleVoice(ctx context.Context, s session, message *tgbotapi.Message) {
+	if h.Transcriber == nil {
+		h.Bot.Send(s.reply("暂不支持语音消息。"))
+		return
+	}
+
+	var fileID, filename string
+	if message.Voice != nil {
+		// 语音消息固定为 OGG/Opus 格式
+		fileID, filename = message.Voice.FileID, "voice.ogg"
+	} else {
+		fileID, filename = message.Audio.FileID, message.Audio.FileName
+		if filename == "" {
+			filename = "audio" + audioExtension(message.Audio.MimeType)
+		}
+	}
+
+	data, err := h.downloadFile(ctx, fileID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to download voice: %v", err))
+		h.Bot.Send(s.reply("下载语音失败，请稍后再试。"))
+		return
+	}
+
+	transcript, err := h.Transcriber.Transcribe(ctx, filename, data)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Transcription error: %v", err))
+		h.Bot.Send(s.reply(failureText(ctx, "语音识别失败，请稍后再试。")))
+		return
+	}
+	if transcript == "" {
+		h.Bot.Send(s.reply("未能识别语音内容。"))
+		return
+	}
+
+	logger.LogUserMessage(s.UserID, "[语音] "+transcript)
+	msg := s.replyf("🎙 识别结果：\n%s", transcript)
+	msg.ReplyToMessageID = message.MessageID
+	h.Bot.Send(msg)
+
+	h.chat(ctx, s, llm.Message{Role: "user", Content: transcript})
+}
+
+// downloadFile 通过 Bot API 文件接口下载文件
+func (h *Handler) downloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	fileURL, err := h.Bot.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MAX_DOWNLOAD_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MAX_DOWNLOAD_SIZE {
+		return nil, fmt.Errorf("file too large")
+	}
+	return data, nil
+}
+
+// isImageDocument 判断以文件形式发送的附件是否为图片
+func isImageDocument(doc *tgbotapi.Document) bool {
+	return doc != nil && strings.HasPrefix(doc.MimeType, "image/")
+}
+
+// audioExtension 根据 MIME 类型推断音频文件扩展名，转写接口依赖扩展名识别格式
+func audioExtension(mimeType string) string {
+	switch mimeType {
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/x-m4a", "audio/m4a":
+		return ".m4a"
+	case "audio/wav", "audio/x-wav":
+		return ".wav"
+	case "audio/webm":
+		return ".webm"
+	case "audio/flac", "audio/x-flac":
+		return ".flac"
+	default:
+		return ".ogg"
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MEMORY_MAX_SOURCE      = 2000 // 超过该长度 (chars) 的原文不写入翻译记忆
+	MEMORY_FUZZY_THRESHOLD = 0.5  // 作为参考的相似原文的最低相似度
+	MEMORY_FUZZY_LIMIT     = 3    // 最多提供的参考译文数
+	MEMORY_LIST_LIMIT      = 20
+	MEMORY_HIT_MARK        = "♻️ 来自翻译记忆"
+)
+
+const memoryUsage = `用法：
+/memory stats - 按预设统计翻译记忆
+/memory list [关键词] - 查看最近使用的记录，或按原文、译文搜索
+/memory show <ID> - 查看记录详情
+/memory delete <ID> - 删除记录
+/memory purge all|<预设命令>|<天数>d - 清空全部、指定预设的记录，或删除多少天内未使用的记录`
+
+// memoryScope 返回本次翻译在翻译记忆中的范围，只有原文与目标语言都确定的翻译 (自动互译预设，或设置了目标语言的预设)
+// 才使用翻译记忆，润色、总结等其他预设的回复不会被当作译文复用。
+// prompt 为最终的 System Prompt (含设置与术语)，其摘要区分不同的提示词，预设或设置修改后不会命中旧译文
+func memoryScope(preset config.PresetItem, prompt, source, target string, userMsg llm.Message) (models.MemoryScope, bool) {
+	text := strings.TrimSpace(userMsg.Content)
+	if preset.Command == "" || source == "" || target == "" {
+		return models.MemoryScope{}, false
+	}
+	if _, _, auto := autoPair(preset); preset.Content == "" && !auto {
+		return models.MemoryScope{}, false
+	}
+	if len(userMsg.Images) > 0 || text == "" || utf8.RuneCountInString(text) > MEMORY_MAX_SOURCE {
+		return models.MemoryScope{}, false
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	return models.MemoryScope{
+		Preset:     preset.Command,
+		Variant:    hex.EncodeToString(sum[:8]),
+		SourceLang: source,
+		TargetLang: target,
+	}, true
+}
+
+// lookupMemory 原文完全相同时返回记录的译文；否则返回相似原文的译文，作为参考示例。
+// 命中了术语时 (glossary 为 true) 不直接复用译文，交给模型按术语重新翻译，旧译文只作为参考
+func (h *Handler) lookupMemory(ctx context.Context, scope models.MemoryScope, text string, glossary bool) (*models.TranslationMemory, []models.TranslationMemory) {
+	db := h.DB.WithContext(ctx)
+	text = strings.TrimSpace(text)
+	exact, err := models.FindExactMemory(db, scope, text)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to look up translation memory: %v", err))
+	}
+	if exact != nil && !glossary {
+		return exact, nil
+	}
+	similar, err := models.FindSimilarMemories(db, scope, text, MEMORY_FUZZY_THRESHOLD, MEMORY_FUZZY_LIMIT, h.TrigramSearch)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to find similar translations: %v", err))
+	}
+	if exact != nil {
+		similar = append([]models.TranslationMemory{*exact}, similar...)
+		if len(similar) > MEMORY_FUZZY_LIMIT {
+			similar = similar[:MEMORY_FUZZY_LIMIT]
+		}
+	}
+	return nil, similar
+}
+
+// rememberTranslation 保存完成的译文
+func (h *Handler) rememberTranslation(ctx context.Context, scope models.MemoryScope, text, translation string) {
+	translation = strings.TrimSpace(translation)
+	if translation == "" {
+		return
+	}
+	if err := models.SaveMemory(h.DB.WithContext(ctx), scope, strings.TrimSpace(text), translation); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to save translation memory: %v", err))
+	}
+}
+
+// memoryPrompt 追加到 System Prompt 的参考译文
+func memoryPrompt(similar []models.TranslationMemory) string {
+	if len(similar) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\n以下是以往相似内容的原文与译文，仅供参考，请保持用词与风格一致，但必须按本次的原文翻译：")
+	for _, m := range similar {
+		fmt.Fprintf(&b, "\n原文：%s\n译文：%s", m.Source, m.Target)
+	}
+	return b.String()
+}
+
+// handleMemoryCommand 处理 /memory，管理员查看与清理翻译记忆
+func (h *Handler) handleMemoryCommand(ctx context.Context, s session, args string) {
+	if !h.isAdmin(ctx, s.UserID) {
+		h.Bot.Send(s.reply("您没有管理员权限。"))
+		return
+	}
+	action, param, _ := strings.Cut(strings.TrimSpace(args), " ")
+	action, param = strings.ToLower(action), strings.TrimSpace(param)
+	db := h.DB.WithContext(ctx)
+
+	switch action {
+	case "stats":
+		stats, err := models.MemoryStats(db)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to get translation memory stats: %v", err))
+			h.Bot.Send(s.reply("获取统计失败，请稍后再试。"))
+			return
+		}
+		if len(stats) == 0 {
+			h.Bot.Send(s.reply("翻译记忆为空。"))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("翻译记忆：\n")
+		for _, stat := range stats {
+			fmt.Fprintf(&b, "%s：%d 条，命中 %d 次\n", stat.Preset, stat.Count, stat.Hits)
+		}
+		h.Bot.Send(s.reply(b.String()))
+
+	case "list":
+		memories, err := models.SearchMemories(db, param, MEMORY_LIST_LIMIT)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to search translation memory: %v", err))
+			h.Bot.Send(s.reply("查询失败，请稍后再试。"))
+			return
+		}
+		if len(memories) == 0 {
+			h.Bot.Send(s.reply("没有找到记录。"))
+			return
+		}
+		var b strings.Builder
+		for _, m := range memories {
+			fmt.Fprintf(&b, "%s\n%s\n\n", m, truncateRunes(m.Source, 60))
+		}
+		b.WriteString("使用 /memory show <ID> 查看译文。")
+		for _, part := range splitRunes(b.String(), MAX_MESSAGE_LENGTH) {
+			h.Bot.Send(s.reply(part))
+		}
+
+	case "show", "delete":
+		id, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			h.Bot.Send(s.reply(memoryUsage))
+			return
+		}
+		if action == "delete" {
+			err = models.DeleteMemory(db, uint(id))
+		} else {
+			var m *models.TranslationMemory
+			if m, err = models.GetMemory(db, uint(id)); err == nil {
+				text := fmt.Sprintf("%s\n最近使用：%s\n\n原文：\n%s\n\n译文：\n%s", m, m.UpdatedAt.Format("2006-01-02 15:04"), m.Source, m.Target)
+				for _, part := range splitRunes(text, MAX_MESSAGE_LENGTH) {
+					h.Bot.Send(s.reply(part))
+				}
+			}
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.Bot.Send(s.reply("记录不存在。"))
+		} else if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to %s translation memory %d: %v", action, id, err))
+			h.Bot.Send(s.reply("操作失败，请稍后再试。"))
+		} else if action == "delete" {
+			h.Bot.Send(s.reply("已删除。"))
+		}
+
+	case "purge":
+		var preset string
+		var before time.Time
+		switch {
+		case param == "all":
+		case strings.HasPrefix(param, "/") || strings.HasPrefix(param, userPresetRefPrefix):
+			preset = param
+		case strings.HasSuffix(param, "d"):
+			days, err := strconv.Atoi(strings.TrimSuffix(param, "d"))
+			if err != nil || days <= 0 {
+				h.Bot.Send(s.reply(memoryUsage))
+				return
+			}
+			before = time.Now().AddDate(0, 0, -days)
+		default:
+			h.Bot.Send(s.reply(memoryUsage))
+			return
+		}
+		count, err := models.PurgeMemories(db, preset, before)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to purge translation memory: %v", err))
+			h.Bot.Send(s.reply("清理失败，请稍后再试。"))
+			return
+		}
+		logger.LogRuntime(fmt.Sprintf("Admin %d purged %d translation memory entries (%s)", s.UserID, count, param))
+		h.Bot.Send(s.replyf("已删除 %d 条记录。", count))
+
+	default:
+		h.Bot.Send(s.reply(memoryUsage))
+	}
+}
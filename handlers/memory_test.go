@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"testing"
+	"tg-bot-go/config"
+	"tg-bot-go/llm"
+)
+
+func TestMemoryScope(t *testing.T) {
+	translate := config.PresetItem{Command: "/translate", Content: "请翻译以下内容。"}
+	auto := config.PresetItem{Command: "/auto", Pair: []string{"zh", "en"}}
+	text := llm.Message{Role: "user", Content: "hello world"}
+
+	tests := []struct {
+		name           string
+		preset         config.PresetItem
+		source, target string
+		msg            llm.Message
+		want           bool
+	}{
+		{"preset with target language", translate, "en", "zh", text, true},
+		{"auto pair preset", auto, "en", "zh", text, true},
+		{"preset without target language", translate, "en", "", text, false},
+		{"undetected source language", translate, "", "zh", text, false},
+		{"default chat", config.PresetItem{}, "en", "zh", text, false},
+		{"preset without content or pair", config.PresetItem{Command: "/empty"}, "en", "zh", text, false},
+		{"image message", translate, "en", "zh", llm.Message{Role: "user", Content: "hi", Images: []llm.Image{{}}}, false},
+		{"blank message", translate, "en", "zh", llm.Message{Role: "user", Content: "  "}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, ok := memoryScope(tt.preset, "prompt", tt.source, tt.target, tt.msg)
+			if ok != tt.want {
+				t.Fatalf("memoryScope enabled = %v, want %v", ok, tt.want)
+			}
+			if ok && (scope.SourceLang != tt.source || scope.TargetLang != tt.target || scope.Preset != tt.preset.Command) {
+				t.Fatalf("unexpected scope %+v", scope)
+			}
+		})
+	}
+}
@@ -1,58 +1,159 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"tg-bot-go/llm"
 	"tg-bot-go/logger"
 	"tg-bot-go/models"
-	"tg-bot-go/openai"
 	"time"
-	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func (h *Handler) HandleMessage(update tgbotapi.Update) {
-	chatID := update.Message.Chat.ID
-	text := update.Message.Text
+// BUSY_SETTINGS_TIMEOUT 提示稍候时读取界面语言的超时，HandleBusy 在接收更新的循环中调用，不能长时间阻塞
+const BUSY_SETTINGS_TIMEOUT = time.Second
+
+func (h *Handler) HandleMessage(ctx context.Context, update tgbotapi.Update) {
+	message := update.Message
+	s := newSession(message)
+	text := message.Text
+
+	// 群聊中只处理命令、@ 机器人以及回复机器人的消息
+	command, isCommand := h.parseCommand(text)
+	if strings.HasPrefix(text, "/") && !isCommand {
+		return
+	}
+	if !isCommand && isGroupChat(message.Chat) && !h.isAddressedToBot(message) {
+		return
+	}
+	s = h.withLang(ctx, s)
 
 	// 1. 限流检查 (每分钟 10 条)
-	if h.isRateLimited(chatID) {
-		msg := tgbotapi.NewMessage(chatID, "您发送消息太快了，请稍后再试。")
-		h.Bot.Send(msg)
+	if h.isRateLimited(ctx, s.UserID) {
+		h.Bot.Send(s.reply("您发送消息太快了，请稍后再试。"))
 		return
 	}
 
 	// 检查是否是命令（以/开头）
-	if strings.HasPrefix(text, "/") {
-		h.handleCommand(update)
+	if isCommand && command != "/tr" {
+		h.handleCommand(ctx, s, update)
 		return
 	}
-	// 检查用户是否在白名单中且未过期
-	isValid, validErr := models.IsUserValid(h.DB, chatID)
-	if validErr != nil {
-		logger.LogRuntime(fmt.Sprintf("检查用户有效性失败：%v", validErr))
-		msg := tgbotapi.NewMessage(chatID, "系统错误，请稍后再试。")
-		h.Bot.Send(msg)
+	// 检查用户是否在白名单中且未过期 (群聊中按发送者鉴权)
+	if !h.checkUserValid(ctx, s) {
 		return
 	}
-	if !isValid {
-		msg := tgbotapi.NewMessage(chatID, "您的使用权限已过期或未获得授权。")
-		h.Bot.Send(msg)
+
+	// 登记为可中止的处理，/cancel 与“停止”按钮通过它中止
+	ctx, done := h.startGeneration(ctx, s)
+	defer done()
+
+	// 正在创建或编辑预设时，文本消息作为向导的输入
+	if !isCommand && h.handlePresetDraft(ctx, s, h.stripMention(text)) {
+		return
+	}
+
+	if isCommand {
+		h.handleTranslateCommand(ctx, s, message)
+		return
+	}
+	h.handleContent(ctx, s, message, h.stripMention(text))
+}
+
+// handleTranslateCommand 处理 /tr <文本>，或回复某条消息发送 /tr 来翻译被回复的消息
+func (h *Handler) handleTranslateCommand(ctx context.Context, s session, message *tgbotapi.Message) {
+	text := strings.TrimSpace(message.CommandArguments())
+	if text != "" {
+		h.handleContent(ctx, s, message, text)
+		return
+	}
+	if message.ReplyToMessage == nil {
+		h.Bot.Send(s.reply("用法：/tr <文本>，或回复一条消息并发送 /tr。"))
+		return
+	}
+	h.handleContent(ctx, s, message.ReplyToMessage, message.ReplyToMessage.Text)
+}
+
+// handleContent 按消息类型分发：图片、文档、语音或文本
+func (h *Handler) handleContent(ctx context.Context, s session, message *tgbotapi.Message, text string) {
+	// 图片 (包括以文件形式发送的图片) 交给视觉模型处理
+	if len(message.Photo) > 0 || isImageDocument(message.Document) {
+		h.handlePhoto(ctx, s, message)
+		return
+	}
+
+	// 文档按段落分块翻译后以同样的格式发回
+	if message.Document != nil {
+		h.handleDocument(ctx, s, message)
+		return
+	}
+
+	// 语音消息与音频文件先转写再按文本处理
+	if message.Voice != nil || message.Audio != nil {
+		h.handleVoice(ctx, s, message)
+		return
+	}
+
+	if text == "" {
 		return
 	}
 
 	// 记录用户消息
-	logger.LogUserMessage(chatID, text)
+	logger.LogUserMessage(s.UserID, text)
 
-	contextKey := fmt.Sprintf("user:%d:context", chatID)
-	presetKey := fmt.Sprintf("user:%d:preset", chatID)
+	h.chat(ctx, s, llm.Message{Role: "user", Content: text})
+}
 
-	// 1. 获取 System Prompt (预设)
-	userPreset, _ := h.Redis.Get(ctx, presetKey).Result()
-	if userPreset == "" {
-		userPreset = "你是一个有帮助的助手。"
+// checkUserValid 检查用户是否在白名单中且未过期，无效时回复提示
+func (h *Handler) checkUserValid(ctx context.Context, s session) bool {
+	isValid, validErr := models.IsUserValid(h.DB.WithContext(ctx), s.UserID)
+	if validErr != nil {
+		logger.LogRuntime(fmt.Sprintf("检查用户有效性失败：%v", validErr))
+		h.Bot.Send(s.reply("系统错误，请稍后再试。"))
+		return false
+	}
+	if !isValid {
+		h.Bot.Send(s.reply("您的使用权限已过期或未获得授权。"))
+		return false
+	}
+	return true
+}
+
+// chat 结合预设与历史上下文调用大模型，流式回复并保存上下文
+func (h *Handler) chat(ctx context.Context, s session, userMsg llm.Message) {
+	contextKey := h.Keys.context(s.ChatID, s.UserID)
+
+	// 1. 获取 System Prompt (预设与个人设置)
+	// 自动互译预设按这条消息的语言决定翻译方向
+	preset, settings := h.activePreset(ctx, s.ChatID)
+	if targets := fanOutTargets(settings); len(targets) > 0 {
+		h.fanOut(ctx, s, preset, settings, targets, userMsg)
+		return
+	}
+	userPreset, direction := presetPrompt(preset, settings, userMsg.Content)
+	// 只注入这条消息中出现的术语
+	source, target := translationLanguages(preset, settings, userMsg.Content)
+	glossary := h.matchGlossary(ctx, s.ChatID, userMsg.Content, source, target)
+	userPreset += glossaryPrompt(glossary)
+
+	// 翻译记忆：原文完全相同时直接复用译文，相似的原文作为参考
+	scope, useMemory := memoryScope(preset, userPreset, source, target, userMsg)
+	if useMemory {
+		exact, similar := h.lookupMemory(ctx, scope, userMsg.Content, len(glossary) > 0)
+		if exact != nil {
+			reply := exact.Target + "\n\n" + s.tr(MEMORY_HIT_MARK)
+			if direction != "" {
+				reply = "🌐 " + direction + "\n\n" + reply
+			}
+			h.sendReply(s, reply)
+			logger.LogUserMessage(s.UserID, exact.Target)
+			h.saveContext(ctx, s, userMsg, exact.Target)
+			return
+		}
+		userPreset += memoryPrompt(similar)
 	}
 
 	// 2. 获取历史记录 (Redis List)
@@ -62,73 +163,118 @@ func (h *Handler) HandleMessage(update tgbotapi.Update) {
 		historyStrs = []string{}
 	}
 
-	var messages []openai.ChatMessage
-	messages = append(messages, openai.ChatMessage{Role: "system", Content: userPreset})
-	
-	currentLength := utf8.RuneCountInString(userPreset)
-	
-	var historyMessages []openai.ChatMessage
-	for _, s := range historyStrs {
-		var msg openai.ChatMessage
-		if err := json.Unmarshal([]byte(s), &msg); err == nil {
+	// 3. 按模型的上下文窗口计算 token 预算，超出时最早的历史在后台压缩进摘要，摘要插在 System Prompt 之后
+	provider := h.providerFor(preset, settings)
+	model := llm.ModelName(provider)
+	budget := h.contextBudget(model, preset)
+
+	var messages []llm.Message
+	messages = append(messages, llm.Message{Role: "system", Content: userPreset})
+	summary := h.loadSummary(ctx, s)
+	if summary != "" {
+		messages = append(messages, summaryMessage(summary))
+	}
+
+	currentTokens := h.messageTokens(model, userMsg)
+	for _, msg := range messages {
+		currentTokens += h.messageTokens(model, msg)
+	}
+
+	var historyMessages []llm.Message
+	var historyTokens []int
+	for _, item := range historyStrs {
+		var msg llm.Message
+		if err := json.Unmarshal([]byte(item), &msg); err == nil {
+			tokens := h.messageTokens(model, msg)
 			historyMessages = append(historyMessages, msg)
-			currentLength += utf8.RuneCountInString(msg.Content)
+			historyTokens = append(historyTokens, tokens)
+			currentTokens += tokens
 		}
 	}
-	
-	userMsg := openai.ChatMessage{Role: "user", Content: text}
-	currentLength += utf8.RuneCountInString(text)
-	
-	// 3. 上下文长度控制
+
+	// 按轮 (用户消息与回复) 移出，摘要中不会出现只有回复的半轮对话
 	removedCount := 0
-	for currentLength > MAX_CONTEXT_LENGTH && len(historyMessages) > 0 {
-		removedMsg := historyMessages[0]
-		historyMessages = historyMessages[1:]
-		currentLength -= utf8.RuneCountInString(removedMsg.Content)
-		removedCount++
+	for currentTokens > budget && removedCount < len(historyMessages) {
+		for _, tokens := range historyTokens[removedCount:min(removedCount+2, len(historyTokens))] {
+			currentTokens -= tokens
+		}
+		removedCount = min(removedCount+2, len(historyMessages))
 	}
 
 	if removedCount > 0 {
-		for i := 0; i < removedCount; i++ {
-			h.Redis.LPop(ctx, contextKey)
-		}
-		logger.LogRuntime(fmt.Sprintf("User %d context trimmed by %d messages", chatID, removedCount))
+		dropped := historyMessages[:removedCount]
+		historyMessages = historyMessages[removedCount:]
+		backend, backendModel := h.backendFor(preset, settings)
+		h.compressHistory(s, backend, backendModel, summary, dropped)
+		logger.LogRuntime(fmt.Sprintf("User %d context in chat %d exceeds budget by %d messages (%s, %d/%d tokens)", s.UserID, s.ChatID, removedCount, model, currentTokens, budget))
 	}
 
 	messages = append(messages, historyMessages...)
 	messages = append(messages, userMsg)
 
-	// 4. 调用 OpenAI
-	response, err := openai.GetOpenAIResponse(messages)
+	// 4. 调用大模型 (流式)，边生成边编辑占位消息
+	writer, err := h.newStreamWriter(s)
 	if err != nil {
-		logger.LogRuntime(fmt.Sprintf("OpenAI API error: %v", err))
-		msg := tgbotapi.NewMessage(chatID, "获取响应失败，请稍后再试。")
-		h.Bot.Send(msg)
+		logger.LogRuntime(fmt.Sprintf("Failed to send placeholder message: %v", err))
+		return
+	}
+	if direction != "" {
+		writer.header = "🌐 " + direction + "\n\n"
+	}
+
+	if len(userMsg.Images) > 0 && !llm.SupportsVision(provider) {
+		writer.Fail("当前模型不支持图片输入。")
+		return
+	}
+	response, err := h.generate(ctx, provider, &llm.Request{Messages: messages}, writer)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("LLM API error (%s): %v", provider.Name(), err))
+		// 用户中止时保留已生成的部分
+		if partial := writer.Partial(); isStopped(ctx) && partial != "" {
+			writer.Finish(partial + s.tr("\n\n（已停止）"))
+			return
+		}
+		writer.Fail(failureText(ctx, "获取响应失败，请稍后再试。"))
 		return
 	}
 
-	// 5. 发送响应
-	msg := tgbotapi.NewMessage(chatID, response)
-	h.Bot.Send(msg)
-	logger.LogUserMessage(chatID, response)
+	// 5. 发送最终响应，未按术语表翻译时附加提示
+	warning := glossaryWarning(s.Lang, glossary, response)
+	writer.Finish(response + warning)
+	logger.LogUserMessage(s.UserID, response)
+	if useMemory && warning == "" {
+		h.rememberTranslation(ctx, scope, userMsg.Content, response)
+	}
 
 	// 6. 保存新消息到 Redis Context
-	userJson, _ := json.Marshal(userMsg)
-	assistantMsg := openai.ChatMessage{Role: "assistant", Content: response}
+	h.saveContext(ctx, s, userMsg, response)
+}
+
+// saveContext 将一轮对话追加到 Redis 中的上下文，并延长上下文与摘要的有效期
+func (h *Handler) saveContext(ctx context.Context, s session, userMsg llm.Message, response string) {
+	contextKey := h.Keys.context(s.ChatID, s.UserID)
+	// 图片数据不写入上下文，只保留文字说明
+	historyMsg := llm.Message{Role: userMsg.Role, Content: userMsg.Content}
+	if len(userMsg.Images) > 0 {
+		historyMsg.Content = strings.TrimSpace("[图片] " + userMsg.Content)
+	}
+	userJson, _ := json.Marshal(historyMsg)
+	assistantMsg := llm.Message{Role: "assistant", Content: response}
 	assistJson, _ := json.Marshal(assistantMsg)
 
 	pipe := h.Redis.Pipeline()
 	pipe.RPush(ctx, contextKey, string(userJson))
 	pipe.RPush(ctx, contextKey, string(assistJson))
-	pipe.Expire(ctx, contextKey, 30*time.Minute)
+	pipe.Expire(ctx, contextKey, CONTEXT_TTL)
+	pipe.Expire(ctx, h.Keys.summary(s.ChatID, s.UserID), CONTEXT_TTL)
 	if _, err := pipe.Exec(ctx); err != nil {
 		logger.LogRuntime(fmt.Sprintf("Failed to update context in Redis: %v", err))
 	}
 }
 
 // isRateLimited 检查用户是否触发限流 (10次/分钟)
-func (h *Handler) isRateLimited(userID int64) bool {
-	key := fmt.Sprintf("ratelimit:%d", userID)
+func (h *Handler) isRateLimited(ctx context.Context, userID int64) bool {
+	key := h.Keys.rateLimit(userID)
 	limit := 10
 	
 	// 使用 Redis INCR 计数
@@ -145,3 +291,24 @@ func (h *Handler) isRateLimited(userID int64) bool {
 	
 	return count > int64(limit)
 }
+
+// HandleBusy 用户的排队消息过多时提示稍候，该更新会被丢弃
+func (h *Handler) HandleBusy(update tgbotapi.Update) {
+	ctx, cancel := context.WithTimeout(context.Background(), BUSY_SETTINGS_TIMEOUT)
+	defer cancel()
+	switch {
+	case update.Message != nil:
+		// 群聊中与机器人无关的消息不提示
+		message := update.Message
+		if _, isCommand := h.parseCommand(message.Text); !isCommand && isGroupChat(message.Chat) && !h.isAddressedToBot(message) {
+			return
+		}
+		h.Bot.Send(h.withLang(ctx, newSession(message)).reply("还在处理您的上一条消息，请稍候再发送。"))
+	case update.CallbackQuery != nil:
+		lang := h.loadSettings(ctx, update.CallbackQuery.Message.Chat.ID).UILanguage
+		callbackResponse := tgbotapi.NewCallback(update.CallbackQuery.ID, tr(lang, "还在处理您的上一条消息，请稍候。"))
+		if _, err := h.Bot.Request(callbackResponse); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Error answering callback query: %v", err))
+		}
+	}
+}
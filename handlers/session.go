@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"unicode/utf16"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// session 一次请求的定位：所在聊天、发起用户，以及群聊中需要回复的消息
+type session struct {
+	ChatID  int64
+	UserID  int64
+	ReplyTo int
+	Lang    string // 界面语言，决定回复文字使用中文还是英文
+}
+
+// newSession 根据消息创建 session，群聊中的回复会引用触发消息，便于区分不同成员
+func newSession(msg *tgbotapi.Message) session {
+	s := session{ChatID: msg.Chat.ID, UserID: msg.Chat.ID}
+	if msg.From != nil {
+		s.UserID = msg.From.ID
+	}
+	if isGroupChat(msg.Chat) {
+		s.ReplyTo = msg.MessageID
+	}
+	return s
+}
+
+// withLang 按聊天设置填入界面语言
+func (h *Handler) withLang(ctx context.Context, s session) session {
+	s.Lang = h.loadSettings(ctx, s.ChatID).UILanguage
+	return s
+}
+
+// reply 构造发往当前聊天的消息，文字按界面语言翻译
+func (s session) reply(text string) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(s.ChatID, s.tr(text))
+	msg.ReplyToMessageID = s.ReplyTo
+	return msg
+}
+
+// replyf 与 reply 相同，先翻译格式串再格式化
+func (s session) replyf(format string, args ...any) tgbotapi.MessageConfig {
+	return s.reply(s.trf(format, args...))
+}
+
+func (s session) tr(text string) string {
+	return tr(s.Lang, text)
+}
+
+func (s session) trf(format string, args ...any) string {
+	return trf(s.Lang, format, args...)
+}
+
+func isGroupChat(chat *tgbotapi.Chat) bool {
+	return chat != nil && (chat.IsGroup() || chat.IsSuperGroup())
+}
+
+// parseCommand 解析消息开头的命令，去掉 @botname 后缀；
+// 发给其他机器人的命令 (如 /start@other_bot) 返回 ok=false
+func (h *Handler) parseCommand(text string) (command string, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", false
+	}
+	command, target, found := strings.Cut(fields[0], "@")
+	if found && !strings.EqualFold(target, h.Bot.Self.UserName) {
+		return "", false
+	}
+	return command, true
+}
+
+// isAddressedToBot 群聊中只有 @ 机器人或回复机器人的消息才会被处理
+func (h *Handler) isAddressedToBot(msg *tgbotapi.Message) bool {
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == h.Bot.Self.ID {
+		return true
+	}
+	return h.isMentioned(msg.Text, msg.Entities) || h.isMentioned(msg.Caption, msg.CaptionEntities)
+}
+
+// isMentioned Telegram 的 entity 偏移量以 UTF-16 code unit 计算
+func (h *Handler) isMentioned(text string, entities []tgbotapi.MessageEntity) bool {
+	units := utf16.Encode([]rune(text))
+	for _, entity := range entities {
+		switch entity.Type {
+		case "mention":
+			if entity.Offset+entity.Length > len(units) {
+				continue
+			}
+			mention := string(utf16.Decode(units[entity.Offset : entity.Offset+entity.Length]))
+			if strings.EqualFold(mention, "@"+h.Bot.Self.UserName) {
+				return true
+			}
+		case "text_mention":
+			if entity.User != nil && entity.User.ID == h.Bot.Self.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stripMention 去掉文本中的 @botname
+func (h *Handler) stripMention(text string) string {
+	mention := "@" + h.Bot.Self.UserName
+	for {
+		i := strings.Index(strings.ToLower(text), strings.ToLower(mention))
+		if i < 0 {
+			return strings.TrimSpace(text)
+		}
+		text = text[:i] + text[i+len(mention):]
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	SETTINGS_CACHE_TTL    = time.Hour // 设置在 Redis 中的缓存时间，数据库为准
+	MAX_TARGET_LANGUAGE   = 32        // 目标语言名称的最大长度 (chars)
+	SETTINGS_RESET_VALUE  = "reset"
+	DEFAULT_SYSTEM_PROMPT = "你是一个有帮助的助手。"
+)
+
+// formalityPrompts 语气设置对应的附加要求
+var formalityPrompts = map[string]string{
+	"formal":   "请使用正式、礼貌的语气。",
+	"informal": "请使用口语化、轻松的语气。",
+}
+
+// uiLanguages 支持的界面语言
+var uiLanguages = map[string]string{
+	"zh": "中文",
+	"en": "English",
+}
+
+// loadSettings 读取聊天设置，优先使用 Redis 缓存；数据库出错时返回空设置
+func (h *Handler) loadSettings(ctx context.Context, chatID int64) models.UserSettings {
+	key := h.Keys.settings(chatID)
+	if cached, err := h.Redis.Get(ctx, key).Bytes(); err == nil {
+		var settings models.UserSettings
+		if err := json.Unmarshal(cached, &settings); err == nil {
+			return settings
+		}
+	}
+
+	settings, err := models.GetUserSettings(h.DB.WithContext(ctx), chatID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to load settings for chat %d: %v", chatID, err))
+		return models.UserSettings{ChatID: chatID}
+	}
+	if data, err := json.Marshal(settings); err == nil {
+		if err := h.Redis.Set(ctx, key, data, SETTINGS_CACHE_TTL).Err(); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to cache settings: %v", err))
+		}
+	}
+	return *settings
+}
+
+// updateSettings 基于数据库中的最新设置修改并保存，随后使缓存失效
+func (h *Handler) updateSettings(ctx context.Context, chatID int64, update func(*models.UserSettings)) error {
+	db := h.DB.WithContext(ctx)
+	settings, err := models.GetUserSettings(db, chatID)
+	if err != nil {
+		return err
+	}
+	update(settings)
+	if err := models.SaveUserSettings(db, settings); err != nil {
+		return err
+	}
+	if err := h.Redis.Del(ctx, h.Keys.settings(chatID)).Err(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to invalidate settings cache: %v", err))
+	}
+	return nil
+}
+
+// activePreset 获取聊天当前选择的预设与设置，未选择预设时返回空预设
+func (h *Handler) activePreset(ctx context.Context, chatID int64) (config.PresetItem, models.UserSettings) {
+	settings := h.loadSettings(ctx, chatID)
+	preset, _ := h.findPreset(ctx, settings.Preset)
+	return preset, settings
+}
+
+// providerFor 返回带有预设生成参数的后端，设置中指定的模型优先于预设
+func (h *Handler) providerFor(preset config.PresetItem, settings models.UserSettings) llm.Provider {
+	provider, model := h.backendFor(preset, settings)
+	return llm.WithDefaults(provider, model, generationParams(preset))
+}
+
+// backendFor 返回预设或设置选择的后端与模型，不含预设的生成参数
+func (h *Handler) backendFor(preset config.PresetItem, settings models.UserSettings) (llm.Provider, string) {
+	if settings.Model != "" {
+		// 格式为 后端[:模型]，未指定模型时使用该后端的默认模型
+		name, model, _ := strings.Cut(settings.Model, ":")
+		return h.LLM.Get(name), model
+	}
+	return h.LLM.Get(preset.Provider), preset.Model
+}
+
+// generationParams 预设中的生成参数
+func generationParams(preset config.PresetItem) llm.Params {
+	return llm.Params{
+		Temperature:    preset.Temperature,
+		TopP:           preset.TopP,
+		MaxTokens:      preset.MaxTokens,
+		Stop:           preset.Stop,
+		ResponseFormat: preset.ResponseFormat,
+	}
+}
+
+// systemPrompt 在预设提示词后追加设置中的目标语言与语气要求
+func systemPrompt(content string, settings models.UserSettings) string {
+	var extra []string
+	if settings.TargetLanguage != "" {
+		extra = append(extra, fmt.Sprintf("请将回复或译文的语言设为%s。", settings.TargetLanguage))
+	}
+	if prompt, ok := formalityPrompts[settings.Formality]; ok {
+		extra = append(extra, prompt)
+	}
+	if len(extra) == 0 {
+		return content
+	}
+	return content + "\n\n" + strings.Join(extra, "")
+}
+
+// handleSettingsCommand 处理 /settings，展示当前设置
+func (h *Handler) handleSettingsCommand(ctx context.Context, s session, group bool) {
+	preset, settings := h.activePreset(ctx, s.ChatID)
+
+	orDefault := func(value string) string {
+		if value == "" {
+			return s.tr("默认")
+		}
+		return value
+	}
+	presetName := s.tr("默认对话")
+	if preset.Command != "" {
+		presetName = fmt.Sprintf("%s (%s)", preset.Button, preset.Command)
+	}
+
+	var b strings.Builder
+	b.WriteString(s.tr("当前设置：\n"))
+	b.WriteString(s.trf("预设 (preset)：%s\n", presetName))
+	b.WriteString(s.trf("目标语言 (target)：%s\n", orDefault(settings.TargetLanguage)))
+	b.WriteString(s.trf("多语言同时翻译 (targets)：%s\n", orDefault(strings.ReplaceAll(settings.Targets, ",", s.tr("、")))))
+	b.WriteString(s.trf("模型 (model)：%s\n", orDefault(settings.Model)))
+	b.WriteString(s.trf("语气 (formality)：%s\n", orDefault(settings.Formality)))
+	b.WriteString(s.trf("界面语言 (lang)：%s\n", orDefault(uiLanguages[settings.UILanguage])))
+	b.WriteString(s.trf("\n使用 /set <项目> <值> 修改，值为 %s 时恢复默认。\n", SETTINGS_RESET_VALUE))
+	b.WriteString(s.trf("可用模型：%s\n", strings.Join(h.LLM.Names(), ", ")))
+	b.WriteString(s.tr("语气：formal、informal；界面语言：zh、en"))
+	if group {
+		b.WriteString(s.tr("\n群聊中的设置对所有成员生效。"))
+	}
+	h.Bot.Send(s.reply(b.String()))
+}
+
+// handleSetCommand 处理 /set <项目> <值>
+func (h *Handler) handleSetCommand(ctx context.Context, s session, args string) {
+	field, value, _ := strings.Cut(strings.TrimSpace(args), " ")
+	value = strings.TrimSpace(value)
+	if field == "" || value == "" {
+		h.Bot.Send(s.reply("用法：/set <项目> <值>，项目可以是 preset、target、targets、model、formality、lang；发送 /settings 查看当前设置。"))
+		return
+	}
+	// 恢复默认即清空该项
+	if strings.EqualFold(value, SETTINGS_RESET_VALUE) {
+		value = ""
+	}
+
+	var apply func(*models.UserSettings)
+	switch strings.ToLower(field) {
+	case "preset":
+		command := value
+		if command != "" {
+			if !strings.HasPrefix(command, "/") {
+				command = "/" + command
+			}
+			if _, ok := config.FindPreset(command); !ok {
+				h.Bot.Send(s.reply("没有这个预设，发送 /start 查看可用的预设。"))
+				return
+			}
+		}
+		apply = func(u *models.UserSettings) { u.Preset = command }
+	case "target":
+		if utf8.RuneCountInString(value) > MAX_TARGET_LANGUAGE {
+			h.Bot.Send(s.replyf("目标语言最多 %d 个字符。", MAX_TARGET_LANGUAGE))
+			return
+		}
+		apply = func(u *models.UserSettings) { u.TargetLanguage = value }
+	case "targets":
+		if value != "" {
+			targets, err := parseFanOutTargets(s.Lang, value)
+			if err != nil {
+				h.Bot.Send(s.reply(err.Error()))
+				return
+			}
+			value = targets
+		}
+		apply = func(u *models.UserSettings) { u.Targets = value }
+	case "model":
+		if name, _, _ := strings.Cut(value, ":"); value != "" && !h.LLM.Has(name) {
+			h.Bot.Send(s.replyf("未配置该后端，可用：%s（可写成 后端:模型）。", strings.Join(h.LLM.Names(), ", ")))
+			return
+		}
+		apply = func(u *models.UserSettings) { u.Model = value }
+	case "formality":
+		value = strings.ToLower(value)
+		if _, ok := formalityPrompts[value]; !ok && value != "" {
+			h.Bot.Send(s.reply("语气只能是 formal 或 informal。"))
+			return
+		}
+		apply = func(u *models.UserSettings) { u.Formality = value }
+	case "lang":
+		value = strings.ToLower(value)
+		if _, ok := uiLanguages[value]; !ok && value != "" {
+			h.Bot.Send(s.reply("界面语言只能是 zh 或 en。"))
+			return
+		}
+		apply = func(u *models.UserSettings) { u.UILanguage = value }
+	default:
+		h.Bot.Send(s.reply("未知的设置项，可以是 preset、target、targets、model、formality、lang。"))
+		return
+	}
+
+	if err := h.updateSettings(ctx, s.ChatID, apply); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to save settings: %v", err))
+		h.Bot.Send(s.reply("保存设置失败，请稍后再试。"))
+		return
+	}
+	// 修改界面语言后立即以新的语言确认
+	if strings.EqualFold(field, "lang") {
+		s.Lang = value
+	}
+	h.Bot.Send(s.reply("设置已保存。"))
+}
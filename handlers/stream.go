@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/render"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	STREAM_EDIT_INTERVAL = 1500 * time.Millisecond // 两次编辑消息之间的最小间隔，避免触发 Telegram 限流
+	MAX_MESSAGE_LENGTH   = 4096                    // Telegram 单条消息最大长度 (chars)
+	STREAM_PLACEHOLDER   = "思考中…"
+	REPLY_MAX_PARTS      = 4 // 回复超过该条数时改为发送文件
+	REPLY_FILE_NAME      = "reply.md"
+)
+
+// streamWriter 将流式输出节流后写入同一条占位消息，生成过程中消息下方带有“停止”按钮
+type streamWriter struct {
+	bot       *tgbotapi.BotAPI
+	chatID    int64
+	messageID int
+	replyTo   int // 群聊中引用的触发消息，续发的分段与文件同样引用它
+	buf       strings.Builder
+	lastText  string
+	lastEdit  time.Time
+	keyboard  bool   // 消息当前是否带有“停止”按钮
+	header    string // 显示在回复开头的说明，例如自动互译时检测到的语言
+	lang      string // 界面语言，用于按钮、错误提示与文件说明
+}
+
+// newStreamWriter 发送占位消息并返回对应的 streamWriter
+func (h *Handler) newStreamWriter(s session) (*streamWriter, error) {
+	msg := s.reply(STREAM_PLACEHOLDER)
+	msg.ReplyMarkup = stopKeyboard(s.Lang)
+	placeholder, err := h.Bot.Send(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		bot:       h.Bot,
+		chatID:    s.ChatID,
+		messageID: placeholder.MessageID,
+		replyTo:   s.ReplyTo,
+		lastText:  msg.Text,
+		lastEdit:  time.Now(),
+		keyboard:  true,
+		lang:      s.Lang,
+	}, nil
+}
+
+// Append 追加一段增量内容，距离上次编辑超过 STREAM_EDIT_INTERVAL 时刷新消息
+func (w *streamWriter) Append(delta string) {
+	w.buf.WriteString(delta)
+	if time.Since(w.lastEdit) < STREAM_EDIT_INTERVAL {
+		return
+	}
+	w.edit(truncateRunes(w.header+w.buf.String(), MAX_MESSAGE_LENGTH-1)+"…", true)
+}
+
+// Partial 返回目前已收到的内容
+func (w *streamWriter) Partial() string {
+	return w.buf.String()
+}
+
+// Finish 用完整回复替换占位消息：Markdown 转换为 HTML，在段落与代码块之间切分后追加发送，
+// 过长的回复在第一条消息之后以文件形式发送全文
+func (w *streamWriter) Finish(text string) {
+	chunks := render.Split(w.header+text, MAX_MESSAGE_LENGTH)
+	if len(chunks) == 0 {
+		return
+	}
+	w.editChunk(chunks[0], false)
+	if len(chunks) > REPLY_MAX_PARTS {
+		sendReplyFile(w.bot, w.chatID, w.replyTo, w.lang, w.header+text)
+		return
+	}
+	for _, chunk := range chunks[1:] {
+		msg := tgbotapi.NewMessage(w.chatID, "")
+		msg.ReplyToMessageID = w.replyTo
+		sendChunk(w.bot, msg, chunk)
+	}
+}
+
+// Fail 将占位消息替换为错误提示，提示按界面语言翻译
+func (w *streamWriter) Fail(text string) {
+	w.edit(tr(w.lang, text), false)
+}
+
+// edit 以纯文本更新消息内容，keyboard 为 false 时同时移除“停止”按钮
+func (w *streamWriter) edit(text string, keyboard bool) {
+	w.editChunk(render.Chunk{Text: text}, keyboard)
+}
+
+// editChunk 更新消息内容，HTML 无法解析时改用纯文本
+func (w *streamWriter) editChunk(chunk render.Chunk, keyboard bool) {
+	text := chunk.Text
+	if chunk.HTML != "" {
+		text = chunk.HTML
+	}
+	if text == "" || (text == w.lastText && keyboard == w.keyboard) {
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(w.chatID, w.messageID, text)
+	if chunk.HTML != "" {
+		edit.ParseMode = tgbotapi.ModeHTML
+	}
+	if keyboard {
+		markup := stopKeyboard(w.lang)
+		edit.ReplyMarkup = &markup
+	}
+	_, err := w.bot.Send(edit)
+	if err != nil && chunk.HTML != "" && isParseError(err) {
+		edit.Text, edit.ParseMode = chunk.Text, ""
+		_, err = w.bot.Send(edit)
+	}
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to edit stream message: %v", err))
+	}
+	w.lastText = text
+	w.lastEdit = time.Now()
+	w.keyboard = keyboard
+}
+
+// sendReply 发送一条完整的回复 (不经过占位消息)，格式处理与 streamWriter.Finish 相同
+func (h *Handler) sendReply(s session, text string) {
+	chunks := render.Split(text, MAX_MESSAGE_LENGTH)
+	if len(chunks) > REPLY_MAX_PARTS {
+		sendChunk(h.Bot, s.reply(""), chunks[0])
+		sendReplyFile(h.Bot, s.ChatID, s.ReplyTo, s.Lang, text)
+		return
+	}
+	for _, chunk := range chunks {
+		sendChunk(h.Bot, s.reply(""), chunk)
+	}
+}
+
+// sendChunk 以 HTML 发送一段回复，Telegram 无法解析时改用纯文本
+func sendChunk(bot *tgbotapi.BotAPI, msg tgbotapi.MessageConfig, chunk render.Chunk) {
+	msg.Text, msg.ParseMode = chunk.HTML, tgbotapi.ModeHTML
+	_, err := bot.Send(msg)
+	if err != nil && isParseError(err) {
+		msg.Text, msg.ParseMode = chunk.Text, ""
+		_, err = bot.Send(msg)
+	}
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send message part: %v", err))
+	}
+}
+
+// sendReplyFile 以 Markdown 文件发送完整回复
+func sendReplyFile(bot *tgbotapi.BotAPI, chatID int64, replyTo int, lang, text string) {
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: REPLY_FILE_NAME, Bytes: []byte(text)})
+	doc.Caption = tr(lang, "回复较长，完整内容见文件。")
+	doc.ReplyToMessageID = replyTo
+	if _, err := bot.Send(doc); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send reply file: %v", err))
+	}
+}
+
+// isParseError 判断是否为 Telegram 无法解析消息格式的错误
+func isParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
+}
+
+// generate 调用后端生成回复，支持流式的后端会实时写入 writer
+func (h *Handler) generate(ctx context.Context, provider llm.Provider, req *llm.Request, writer *streamWriter) (string, error) {
+	if streamer, ok := provider.(llm.Streamer); ok {
+		return streamer.ChatStream(ctx, req, writer.Append)
+	}
+	return provider.Chat(ctx, req)
+}
+
+// truncateRunes 按字符数截断字符串
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// splitRunes 按字符数将字符串切分为多段
+func splitRunes(s string, size int) []string {
+	var parts []string
+	runes := []rune(s)
+	for len(runes) > size {
+		parts = append(parts, string(runes[:size]))
+		runes = runes[size:]
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
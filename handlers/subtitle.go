@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/document"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"tg-bot-go/subtitle"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const SUBTITLE_BATCH_SIZE = 40 // 每次请求翻译的字幕条数
+
+// handleSubtitle 分批翻译字幕文本，序号与时间轴保持不变，校验条数后发回同格式的字幕文件
+func (h *Handler) handleSubtitle(ctx context.Context, s session, message *tgbotapi.Message, preset config.PresetItem, settings models.UserSettings, format document.Format, data []byte) {
+	fileName := message.Document.FileName
+
+	if !utf8.Valid(data) {
+		h.Bot.Send(s.reply("文件不是 UTF-8 编码，请转换后再发送。"))
+		return
+	}
+
+	file, err := subtitle.Parse(subtitle.Format(format), string(data))
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to parse subtitle: %v", err))
+		h.Bot.Send(s.reply("无法解析该字幕文件，请检查格式。"))
+		return
+	}
+
+	cues := file.Cues()
+	if len(cues) == 0 {
+		h.Bot.Send(s.reply("字幕文件中没有可翻译的内容。"))
+		return
+	}
+	var batches [][]*subtitle.Cue
+	for start := 0; start < len(cues); start += SUBTITLE_BATCH_SIZE {
+		end := start + SUBTITLE_BATCH_SIZE
+		if end > len(cues) {
+			end = len(cues)
+		}
+		batches = append(batches, cues[start:end])
+	}
+	if len(batches) > DOCUMENT_MAX_CHUNKS {
+		h.Bot.Send(s.reply("字幕文件过大，请拆分后再发送。"))
+		return
+	}
+
+	// 自动互译预设按第一批字幕决定翻译方向
+	var sample strings.Builder
+	for _, cue := range batches[0] {
+		sample.WriteString(strings.Join(cue.Lines, "\n") + "\n")
+	}
+	prompt, direction := presetPrompt(preset, settings, sample.String())
+	title := s.trf("正在翻译字幕 %s（%d 条）", fileName, len(cues))
+	if direction != "" {
+		title = s.trf("正在翻译字幕 %s（%d 条，%s）", fileName, len(cues), direction)
+	}
+	progress := h.newProgress(s, title, len(batches))
+	provider := h.providerFor(preset, settings)
+	prompt += subtitle.Instruction
+
+	results := make([][][]string, len(batches))
+	err = runParallel(ctx, len(batches), DOCUMENT_CONCURRENCY, func(ctx context.Context, i int) error {
+		texts, err := h.translateCues(ctx, provider, prompt, batches[i])
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", i, err)
+		}
+		results[i] = texts
+		return nil
+	}, progress.Done)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Subtitle translation error (%s): %v", provider.Name(), err))
+		progress.Finish(failureText(ctx, "翻译字幕失败，请稍后再试。"))
+		return
+	}
+
+	var texts [][]string
+	for _, batch := range results {
+		texts = append(texts, batch...)
+	}
+	if err := file.SetText(texts); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Subtitle validation error: %v", err))
+		progress.Finish("翻译后的字幕条数与原文不一致，请稍后再试。")
+		return
+	}
+
+	progress.Finish(s.trf("%s 翻译完成，共 %d 条字幕。", fileName, len(cues)))
+	reply := tgbotapi.NewDocument(s.ChatID, tgbotapi.FileBytes{
+		Name:  translatedFileName(fileName),
+		Bytes: []byte(file.String()),
+	})
+	reply.ReplyToMessageID = message.MessageID
+	if _, err := h.Bot.Send(reply); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to send translated subtitle: %v", err))
+	}
+}
+
+// translateCues 翻译一批字幕；模型返回的条数不匹配时将该批对半拆分后重试，直到单条仍失败为止
+func (h *Handler) translateCues(ctx context.Context, provider llm.Provider, systemPrompt string, cues []*subtitle.Cue) ([][]string, error) {
+	text, err := provider.Chat(ctx, &llm.Request{Messages: []llm.Message{
+		{Role: "system", Content: systemPrompt},
+		{Role: "user", Content: subtitle.EncodeBatch(cues)},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	texts, err := subtitle.DecodeBatch(text, len(cues))
+	if err == nil {
+		return texts, nil
+	}
+	if len(cues) == 1 {
+		return nil, err
+	}
+
+	logger.LogRuntime(fmt.Sprintf("Subtitle batch of %d cues mismatched (%v), splitting", len(cues), err))
+	mid := len(cues) / 2
+	first, err := h.translateCues(ctx, provider, systemPrompt, cues[:mid])
+	if err != nil {
+		return nil, err
+	}
+	second, err := h.translateCues(ctx, provider, systemPrompt, cues[mid:])
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
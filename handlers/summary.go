@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"tg-bot-go/llm"
+	"tg-bot-go/logger"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	SUMMARY_MAX_TOKENS = 512             // 摘要回复的最大长度
+	SUMMARY_TIMEOUT    = 2 * time.Minute // 单次摘要任务的最长时间
+	SUMMARY_LOCK_TTL   = 3 * time.Minute // 摘要锁的过期时间，任务异常退出时自动释放
+	SUMMARY_PROMPT     = `你负责压缩一段对话的早期内容。请把“已有摘要”与“新增对话”合并为一份新的摘要：
+- 保留用户的身份、目标、偏好、约定的用词与格式要求，以及仍未解决的问题；
+- 保留对后续对话有用的事实、名称、数字与结论，省略寒暄和重复内容；
+- 使用第三人称、简洁的要点，总长度不超过 300 字；
+- 只输出摘要本身，不要添加任何说明。`
+)
+
+// loadSummary 读取此前对话的摘要，不存在时返回空字符串
+func (h *Handler) loadSummary(ctx context.Context, s session) string {
+	summary, err := h.Redis.Get(ctx, h.Keys.summary(s.ChatID, s.UserID)).Result()
+	if err != nil && err != redis.Nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to get summary: %v", err))
+	}
+	return summary
+}
+
+// summaryMessage 插在 System Prompt 之后的摘要消息
+func summaryMessage(summary string) llm.Message {
+	return llm.Message{Role: "system", Content: "以下是本次对话早期内容的摘要，供理解上下文参考：\n" + summary}
+}
+
+// compressHistory 在后台把超出预算的最早几条消息与已有摘要合并为新的摘要，完成后再从上下文中移除这些消息。
+// 同一上下文同时只运行一个任务；摘要失败时不修改上下文，下一轮对话超出预算时重试，没有摘要的消息不会被丢弃
+func (h *Handler) compressHistory(s session, provider llm.Provider, model, previous string, dropped []llm.Message) {
+	h.goBackground(func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, SUMMARY_TIMEOUT)
+		defer cancel()
+
+		lockKey := h.Keys.summaryLock(s.ChatID, s.UserID)
+		locked, err := h.Redis.SetNX(ctx, lockKey, 1, SUMMARY_LOCK_TTL).Result()
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to acquire summary lock: %v", err))
+			return
+		}
+		if !locked {
+			return
+		}
+		defer h.Redis.Del(context.Background(), lockKey)
+
+		summary, err := summarize(ctx, llm.WithDefaults(provider, model, llm.Params{MaxTokens: SUMMARY_MAX_TOKENS}), previous, dropped)
+		if err == nil && summary == "" {
+			err = errors.New("empty summary")
+		}
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to summarize context of user %d in chat %d, context kept for retry: %v", s.UserID, s.ChatID, err))
+			return
+		}
+
+		// 期间上下文可能被清空 (切换预设、/clear) 并开始了新的对话：只有上下文开头仍是被摘要的这些消息时才写入，
+		// WATCH 保证检查与写入之间上下文没有被修改
+		contextKey := h.Keys.context(s.ChatID, s.UserID)
+		err = h.Redis.Watch(ctx, func(tx *redis.Tx) error {
+			head, err := tx.LRange(ctx, contextKey, 0, int64(len(dropped))-1).Result()
+			if err != nil {
+				return err
+			}
+			if !sameMessages(head, dropped) {
+				return errContextChanged
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, h.Keys.summary(s.ChatID, s.UserID), summary, CONTEXT_TTL)
+				pipe.LTrim(ctx, contextKey, int64(len(dropped)), -1)
+				return nil
+			})
+			return err
+		}, contextKey)
+		switch {
+		case err == errContextChanged || err == redis.TxFailedErr:
+			logger.LogRuntime(fmt.Sprintf("User %d context in chat %d changed during summarization, summary discarded", s.UserID, s.ChatID))
+		case err != nil:
+			logger.LogRuntime(fmt.Sprintf("Failed to save summary: %v", err))
+		default:
+			logger.LogRuntime(fmt.Sprintf("User %d context in chat %d compressed %d messages into summary", s.UserID, s.ChatID, len(dropped)))
+		}
+	})
+}
+
+// errContextChanged 摘要期间上下文已被清空或替换
+var errContextChanged = errors.New("context changed")
+
+// sameMessages 判断 Redis 中的上下文开头是否就是 messages
+func sameMessages(stored []string, messages []llm.Message) bool {
+	if len(stored) != len(messages) {
+		return false
+	}
+	for i, raw := range stored {
+		var msg llm.Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil || msg.Role != messages[i].Role || msg.Content != messages[i].Content {
+			return false
+		}
+	}
+	return true
+}
+
+// summarize 调用大模型生成新的摘要
+func summarize(ctx context.Context, provider llm.Provider, previous string, dropped []llm.Message) (string, error) {
+	var b strings.Builder
+	if previous != "" {
+		fmt.Fprintf(&b, "已有摘要：\n%s\n\n", previous)
+	}
+	b.WriteString("新增对话：\n")
+	for _, msg := range dropped {
+		role := "用户"
+		if msg.Role == "assistant" {
+			role = "助手"
+		}
+		fmt.Fprintf(&b, "%s：%s\n", role, msg.Content)
+	}
+
+	summary, err := provider.Chat(ctx, &llm.Request{Messages: []llm.Message{
+		{Role: "system", Content: SUMMARY_PROMPT},
+		{Role: "user", Content: b.String()},
+	}})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"tg-bot-go/llm"
+)
+
+func TestSameMessages(t *testing.T) {
+	messages := []llm.Message{{Role: "user", Content: "你好"}, {Role: "assistant", Content: "你好！"}}
+	var stored []string
+	for _, m := range messages {
+		data, _ := json.Marshal(m)
+		stored = append(stored, string(data))
+	}
+
+	if !sameMessages(stored, messages) {
+		t.Fatal("stored context should match the summarized messages")
+	}
+	if sameMessages(stored[:1], messages) {
+		t.Fatal("a shorter context should not match")
+	}
+	replaced := []string{stored[0], `{"role":"assistant","content":"新的对话"}`}
+	if sameMessages(replaced, messages) {
+		t.Fatal("a context replaced after /clear should not match")
+	}
+	if sameMessages([]string{"not json", stored[1]}, messages) {
+		t.Fatal("malformed entries should not match")
+	}
+}
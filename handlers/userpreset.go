@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tg-bot-go/config"
+	"tg-bot-go/logger"
+	"tg-bot-go/models"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	USER_PRESET_MAX_NAME    = 32               // 预设名称的最大长度 (chars)
+	USER_PRESET_MAX_CONTENT = 2000             // 预设提示词的最大长度 (chars)
+	USER_PRESET_MAX_COUNT   = 20               // 每个用户最多保存的预设数
+	PRESET_DRAFT_TTL        = 10 * time.Minute // 创建或编辑预设的向导超时时间
+
+	userPresetRefPrefix   = "user:" // 设置中引用用户预设的前缀，格式为 user:<id>
+	userPresetCallback    = "up:"   // 用户预设按钮的回调数据前缀，格式为 up:<动作>:<id>
+	presetDraftKeep       = "-"     // 编辑时发送该值表示保持原内容
+	presetDraftStepName   = "name"
+	presetDraftStepPrompt = "content"
+)
+
+// presetDraft 创建或编辑预设的向导状态，保存在 Redis 中
+type presetDraft struct {
+	Step     string `json:"step"`
+	PresetID uint   `json:"preset_id,omitempty"` // 编辑已有预设时非零
+	Name     string `json:"name,omitempty"`
+}
+
+func userPresetRef(id uint) string {
+	return fmt.Sprintf("%s%d", userPresetRefPrefix, id)
+}
+
+func parseUserPresetRef(ref string) (uint, bool) {
+	if !strings.HasPrefix(ref, userPresetRefPrefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(ref, userPresetRefPrefix), 10, 64)
+	return uint(id), err == nil
+}
+
+// findPreset 按命令查找全局预设，或按 user:<id> 查找用户预设
+func (h *Handler) findPreset(ctx context.Context, command string) (config.PresetItem, bool) {
+	id, ok := parseUserPresetRef(command)
+	if !ok {
+		return config.FindPreset(command)
+	}
+	preset, err := models.GetUserPreset(h.DB.WithContext(ctx), id)
+	if err != nil || !preset.Usable() {
+		return config.PresetItem{}, false
+	}
+	return config.PresetItem{Button: preset.Name, Command: command, Content: preset.Content}, true
+}
+
+// presetKeyboard /start 与 /clear 展示的预设按钮：全局预设、用户自己的预设，以及帮助和关于
+func (h *Handler) presetKeyboard(ctx context.Context, s session) tgbotapi.InlineKeyboardMarkup {
+	var buttons [][]tgbotapi.InlineKeyboardButton
+	for _, item := range config.Presets() {
+		button := tgbotapi.NewInlineKeyboardButtonData(item.Button, item.Command)
+		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
+	}
+
+	presets, err := models.ListUserPresets(h.DB.WithContext(ctx), s.UserID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to list user presets: %v", err))
+	}
+	for _, preset := range presets {
+		if !preset.Usable() {
+			continue
+		}
+		button := tgbotapi.NewInlineKeyboardButtonData("⭐ "+preset.Name, userPresetCallbackData("use", preset.ID))
+		buttons = append(buttons, []tgbotapi.InlineKeyboardButton{button})
+	}
+
+	// 添加帮助和关于按钮
+	helpAboutRow := []tgbotapi.InlineKeyboardButton{
+		tgbotapi.NewInlineKeyboardButtonData(s.tr("帮助"), "/help"),
+		tgbotapi.NewInlineKeyboardButtonData(s.tr("关于"), "/about"),
+	}
+	buttons = append(buttons, helpAboutRow)
+	return tgbotapi.NewInlineKeyboardMarkup(buttons...)
+}
+
+func userPresetCallbackData(action string, id uint) string {
+	return fmt.Sprintf("%s%s:%d", userPresetCallback, action, id)
+}
+
+// handleNewPresetCommand 处理 /newpreset，开始创建预设的向导
+func (h *Handler) handleNewPresetCommand(ctx context.Context, s session) {
+	count, err := models.CountUserPresets(h.DB.WithContext(ctx), s.UserID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to count user presets: %v", err))
+		h.Bot.Send(s.reply("系统错误，请稍后再试。"))
+		return
+	}
+	if count >= USER_PRESET_MAX_COUNT {
+		h.Bot.Send(s.replyf("最多只能保存 %d 个预设，请先通过 /mypresets 删除不用的预设。", USER_PRESET_MAX_COUNT))
+		return
+	}
+	if !h.savePresetDraft(ctx, s, presetDraft{Step: presetDraftStepName}) {
+		return
+	}
+	h.Bot.Send(s.replyf("请发送预设名称（最多 %d 个字），发送 /cancel 取消。", USER_PRESET_MAX_NAME))
+}
+
+// handlePresetDraft 用户处于创建或编辑预设的向导中时，将文本消息作为向导的输入；没有向导时返回 false
+func (h *Handler) handlePresetDraft(ctx context.Context, s session, text string) bool {
+	data, err := h.Redis.Get(ctx, h.Keys.presetDraft(s.ChatID, s.UserID)).Bytes()
+	if err != nil {
+		return false
+	}
+	var draft presetDraft
+	if err := json.Unmarshal(data, &draft); err != nil {
+		return false
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		h.Bot.Send(s.reply("请发送文字内容，或发送 /cancel 取消。"))
+		return true
+	}
+	keep := draft.PresetID != 0 && text == presetDraftKeep
+
+	switch draft.Step {
+	case presetDraftStepName:
+		if !keep && utf8.RuneCountInString(text) > USER_PRESET_MAX_NAME {
+			h.Bot.Send(s.replyf("名称最多 %d 个字，请重新发送。", USER_PRESET_MAX_NAME))
+			return true
+		}
+		if !keep {
+			draft.Name = text
+		}
+		draft.Step = presetDraftStepPrompt
+		if !h.savePresetDraft(ctx, s, draft) {
+			return true
+		}
+		prompt := s.trf("请发送预设的提示词（System Prompt，最多 %d 个字）。", USER_PRESET_MAX_CONTENT)
+		if draft.PresetID != 0 {
+			prompt += s.trf("发送 %s 保持不变。", presetDraftKeep)
+		}
+		h.Bot.Send(s.reply(prompt))
+
+	case presetDraftStepPrompt:
+		if !keep && utf8.RuneCountInString(text) > USER_PRESET_MAX_CONTENT {
+			h.Bot.Send(s.replyf("提示词最多 %d 个字，请精简后重新发送。", USER_PRESET_MAX_CONTENT))
+			return true
+		}
+		content := text
+		if keep {
+			content = ""
+		}
+		h.finishPresetDraft(ctx, s, draft, content)
+
+	default:
+		h.clearPresetDraft(ctx, s)
+		return false
+	}
+	return true
+}
+
+// finishPresetDraft 保存向导的结果；content 为空表示保持原提示词
+func (h *Handler) finishPresetDraft(ctx context.Context, s session, draft presetDraft, content string) {
+	db := h.DB.WithContext(ctx)
+	defer h.clearPresetDraft(ctx, s)
+
+	if draft.PresetID == 0 {
+		preset := &models.UserPreset{OwnerID: s.UserID, Name: draft.Name, Content: content}
+		if err := models.CreateUserPreset(db, preset); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to create user preset: %v", err))
+			h.Bot.Send(s.reply("保存预设失败，请稍后再试。"))
+			return
+		}
+		h.Bot.Send(s.replyf("预设「%s」已创建，发送 /start 即可选用，/mypresets 管理。", preset.Name))
+		return
+	}
+
+	preset, ok := h.ownedPreset(ctx, s, draft.PresetID)
+	if !ok {
+		return
+	}
+	if draft.Name != "" {
+		preset.Name = draft.Name
+	}
+	if content != "" && content != preset.Content {
+		preset.Content = content
+		// 已分享的预设修改提示词后需要重新审核
+		switch preset.Status {
+		case models.PresetStatusPending, models.PresetStatusApproved:
+			preset.Status = models.PresetStatusPending
+		case models.PresetStatusRejected:
+			preset.Status = models.PresetStatusPrivate
+		}
+	}
+	if err := models.UpdateUserPreset(db, preset); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to update user preset: %v", err))
+		h.Bot.Send(s.reply("保存预设失败，请稍后再试。"))
+		return
+	}
+	h.Bot.Send(s.replyf("预设「%s」已更新。", preset.Name))
+}
+
+func (h *Handler) savePresetDraft(ctx context.Context, s session, draft presetDraft) bool {
+	data, _ := json.Marshal(draft)
+	if err := h.Redis.Set(ctx, h.Keys.presetDraft(s.ChatID, s.UserID), data, PRESET_DRAFT_TTL).Err(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to save preset draft: %v", err))
+		h.Bot.Send(s.reply("系统错误，请稍后再试。"))
+		return false
+	}
+	return true
+}
+
+// clearPresetDraft 结束向导，存在进行中的向导时返回 true
+func (h *Handler) clearPresetDraft(ctx context.Context, s session) bool {
+	n, err := h.Redis.Del(ctx, h.Keys.presetDraft(s.ChatID, s.UserID)).Result()
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to delete preset draft: %v", err))
+	}
+	return n > 0
+}
+
+// ownedPreset 获取用户自己的预设，不存在或不属于该用户时回复提示
+func (h *Handler) ownedPreset(ctx context.Context, s session, id uint) (*models.UserPreset, bool) {
+	preset, err := models.GetUserPreset(h.DB.WithContext(ctx), id)
+	if err != nil || preset.OwnerID != s.UserID {
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.LogRuntime(fmt.Sprintf("Failed to get user preset: %v", err))
+		}
+		h.Bot.Send(s.reply("预设不存在。"))
+		return nil, false
+	}
+	return preset, true
+}
+
+// handleMyPresetsCommand 处理 /mypresets，列出用户的预设及管理按钮
+func (h *Handler) handleMyPresetsCommand(ctx context.Context, s session) {
+	presets, err := models.ListUserPresets(h.DB.WithContext(ctx), s.UserID)
+	if err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to list user presets: %v", err))
+		h.Bot.Send(s.reply("获取预设列表失败，请稍后再试。"))
+		return
+	}
+	if len(presets) == 0 {
+		h.Bot.Send(s.reply("您还没有自定义预设，发送 /newpreset 创建一个。"))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(s.tr("我的预设：\n\n"))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, preset := range presets {
+		fmt.Fprintf(&b, "#%d %s（%s）\n%s\n\n", preset.ID, preset.Name, presetStatusText(s.Lang, preset.Status), truncateRunes(preset.Content, 100))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(s.trf("使用 #%d", preset.ID), userPresetCallbackData("use", preset.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(s.tr("编辑"), userPresetCallbackData("edit", preset.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(s.tr("分享"), userPresetCallbackData("share", preset.ID)),
+			tgbotapi.NewInlineKeyboardButtonData(s.tr("删除"), userPresetCallbackData("delete", preset.ID)),
+		))
+	}
+	b.WriteString(s.tr("发送 /newpreset 创建新预设，/importpreset <分享码> 导入他人分享的预设。"))
+
+	msg := s.reply(b.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	h.Bot.Send(msg)
+}
+
+// handleUserPresetCallback 处理用户预设的使用、编辑、分享与删除按钮
+func (h *Handler) handleUserPresetCallback(ctx context.Context, s session, callback *tgbotapi.CallbackQuery) {
+	action, idText, _ := strings.Cut(strings.TrimPrefix(callback.Data, userPresetCallback), ":")
+	id, err := strconv.ParseUint(idText, 10, 64)
+
+	if err == nil {
+		switch action {
+		case "use":
+			h.useUserPreset(ctx, s, uint(id))
+		case "edit":
+			if preset, ok := h.ownedPreset(ctx, s, uint(id)); ok && h.savePresetDraft(ctx, s, presetDraft{Step: presetDraftStepName, PresetID: preset.ID}) {
+				h.Bot.Send(s.replyf("正在编辑「%s」。请发送新的名称，发送 %s 保持不变，发送 /cancel 取消。", preset.Name, presetDraftKeep))
+			}
+		case "share":
+			h.shareUserPreset(ctx, s, uint(id))
+		case "delete":
+			if err := models.DeleteUserPreset(h.DB.WithContext(ctx), s.UserID, uint(id)); err != nil {
+				h.Bot.Send(s.reply("删除预设失败，预设不存在或不属于您。"))
+			} else {
+				h.Bot.Send(s.reply("预设已删除。"))
+			}
+		}
+	}
+
+	if _, err := h.Bot.Request(tgbotapi.NewCallback(callback.ID, "")); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Error answering callback query: %v", err))
+	}
+}
+
+// useUserPreset 将用户自己的预设设为当前聊天的预设 (群聊中对整个群生效)
+func (h *Handler) useUserPreset(ctx context.Context, s session, id uint) {
+	preset, ok := h.ownedPreset(ctx, s, id)
+	if !ok {
+		return
+	}
+	if !preset.Usable() {
+		h.Bot.Send(s.reply("该预设已被管理员禁用。"))
+		return
+	}
+	if err := h.updateSettings(ctx, s.ChatID, func(u *models.UserSettings) { u.Preset = userPresetRef(preset.ID) }); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to save preset: %v", err))
+		h.Bot.Send(s.reply("设置预设失败，请稍后再试。"))
+		return
+	}
+	if err := h.Redis.Del(ctx, h.Keys.context(s.ChatID, s.UserID), h.Keys.summary(s.ChatID, s.UserID)).Err(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to delete context: %v", err))
+	}
+	h.Bot.Send(s.replyf("已切换到%s，您可以开始对话了。", preset.Name))
+}
+
+// shareUserPreset 申请分享预设，审核通过后其他用户可以凭分享码导入
+func (h *Handler) shareUserPreset(ctx context.Context, s session, id uint) {
+	preset, ok := h.ownedPreset(ctx, s, id)
+	if !ok {
+		return
+	}
+	switch preset.Status {
+	case models.PresetStatusDisabled:
+		h.Bot.Send(s.reply("该预设已被管理员禁用，无法分享。"))
+		return
+	case models.PresetStatusApproved:
+		h.Bot.Send(s.replyf("分享码：%s\n其他用户发送 /importpreset %s 即可导入。", preset.ShareCode, preset.ShareCode))
+		return
+	case models.PresetStatusPending:
+		h.Bot.Send(s.reply("该预设正在等待管理员审核。"))
+		return
+	}
+
+	if err := models.SetUserPresetStatus(h.DB.WithContext(ctx), preset.ID, models.PresetStatusPending); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to update preset status: %v", err))
+		h.Bot.Send(s.reply("申请分享失败，请稍后再试。"))
+		return
+	}
+	h.Bot.Send(s.replyf("已提交审核。审核通过后，其他用户发送 /importpreset %s 即可导入。", preset.ShareCode))
+
+	// 通知管理员
+	for _, adminID := range config.Config.Admin.AdminUserIDs {
+		h.Bot.Send(tgbotapi.NewMessage(adminID, fmt.Sprintf("用户 %d 申请分享预设 #%d「%s」，发送 /presetqueue 查看待审核预设。", s.UserID, preset.ID, preset.Name)))
+	}
+}
+
+// handleImportPresetCommand 处理 /importpreset <分享码>，复制一份审核通过的预设
+func (h *Handler) handleImportPresetCommand(ctx context.Context, s session, code string) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		h.Bot.Send(s.reply("用法：/importpreset <分享码>"))
+		return
+	}
+	db := h.DB.WithContext(ctx)
+	shared, err := models.FindSharedPreset(db, code)
+	if err != nil {
+		h.Bot.Send(s.reply("分享码无效或预设尚未通过审核。"))
+		return
+	}
+	count, err := models.CountUserPresets(db, s.UserID)
+	if err != nil || count >= USER_PRESET_MAX_COUNT {
+		h.Bot.Send(s.replyf("最多只能保存 %d 个预设，请先通过 /mypresets 删除不用的预设。", USER_PRESET_MAX_COUNT))
+		return
+	}
+	preset := &models.UserPreset{OwnerID: s.UserID, Name: shared.Name, Content: shared.Content}
+	if err := models.CreateUserPreset(db, preset); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to import user preset: %v", err))
+		h.Bot.Send(s.reply("导入预设失败，请稍后再试。"))
+		return
+	}
+	h.Bot.Send(s.replyf("已导入预设「%s」，发送 /start 即可选用。", preset.Name))
+}
+
+// handlePresetAdminCommand 管理员审核用户预设：/presetqueue、/approvepreset、/rejectpreset、/disablepreset
+func (h *Handler) handlePresetAdminCommand(ctx context.Context, s session, command, args string) {
+	db := h.DB.WithContext(ctx)
+	if !h.isAdmin(ctx, s.UserID) {
+		h.Bot.Send(s.reply("您没有管理员权限。"))
+		return
+	}
+
+	if command == "/presetqueue" {
+		presets, err := models.ListPendingPresets(db)
+		if err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to list pending presets: %v", err))
+			h.Bot.Send(s.reply("获取待审核预设失败。"))
+			return
+		}
+		if len(presets) == 0 {
+			h.Bot.Send(s.reply("没有待审核的预设。"))
+			return
+		}
+		var b strings.Builder
+		b.WriteString("待审核预设：\n\n")
+		for _, preset := range presets {
+			fmt.Fprintf(&b, "#%d「%s」用户 %d\n%s\n\n", preset.ID, preset.Name, preset.OwnerID, truncateRunes(preset.Content, 500))
+		}
+		b.WriteString("使用 /approvepreset <ID> 通过，/rejectpreset <ID> 拒绝，/disablepreset <ID> 禁用。")
+		for _, part := range splitRunes(b.String(), MAX_MESSAGE_LENGTH) {
+			h.Bot.Send(s.reply(part))
+		}
+		return
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSpace(args), 10, 64)
+	if err != nil {
+		h.Bot.Send(s.replyf("格式错误。正确格式：%s <预设ID>", command))
+		return
+	}
+	preset, err := models.GetUserPreset(db, uint(id))
+	if err != nil {
+		h.Bot.Send(s.replyf("预设 #%d 不存在。", id))
+		return
+	}
+
+	// 通知按预设所有者私聊的界面语言发送
+	ownerLang := h.loadSettings(ctx, preset.OwnerID).UILanguage
+	var status, notice string
+	switch command {
+	case "/approvepreset":
+		status, notice = models.PresetStatusApproved, trf(ownerLang, "您的预设「%s」已通过审核，分享码：%s", preset.Name, preset.ShareCode)
+	case "/rejectpreset":
+		status, notice = models.PresetStatusRejected, trf(ownerLang, "您的预设「%s」的分享申请未通过审核，您仍可以自己使用。", preset.Name)
+	case "/disablepreset":
+		status, notice = models.PresetStatusDisabled, trf(ownerLang, "您的预设「%s」已被管理员禁用。", preset.Name)
+	}
+	if err := models.SetUserPresetStatus(db, preset.ID, status); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to update preset status: %v", err))
+		h.Bot.Send(s.reply("更新预设状态失败。"))
+		return
+	}
+	h.Bot.Send(s.replyf("预设 #%d 已设为%s。", preset.ID, presetStatusText("", status)))
+	h.Bot.Send(tgbotapi.NewMessage(preset.OwnerID, notice))
+}
+
+// isAdmin 检查用户是否是管理员
+func (h *Handler) isAdmin(ctx context.Context, userID int64) bool {
+	var admin models.WhitelistUser
+	return h.DB.WithContext(ctx).Where("user_id = ? AND is_admin = ?", userID, true).First(&admin).Error == nil
+}
+
+func presetStatusText(lang, status string) string {
+	switch status {
+	case models.PresetStatusPending:
+		return tr(lang, "待审核")
+	case models.PresetStatusApproved:
+		return tr(lang, "已分享")
+	case models.PresetStatusRejected:
+		return tr(lang, "分享未通过")
+	case models.PresetStatusDisabled:
+		return tr(lang, "已禁用")
+	default:
+		return tr(lang, "仅自己可用")
+	}
+}
@@ -0,0 +1,161 @@
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 语言代码使用 ISO 639-1
+const (
+	Chinese    = "zh"
+	Japanese   = "ja"
+	Korean     = "ko"
+	English    = "en"
+	Russian    = "ru"
+	Ukrainian  = "uk"
+	French     = "fr"
+	German     = "de"
+	Spanish    = "es"
+	Italian    = "it"
+	Portuguese = "pt"
+	Arabic     = "ar"
+	Thai       = "th"
+	Hindi      = "hi"
+	Greek      = "el"
+	Hebrew     = "he"
+)
+
+var names = map[string]string{
+	Chinese: "中文", Japanese: "日语", Korean: "韩语", English: "英语", Russian: "俄语", Ukrainian: "乌克兰语",
+	French: "法语", German: "德语", Spanish: "西班牙语", Italian: "意大利语", Portuguese: "葡萄牙语",
+	Arabic: "阿拉伯语", Thai: "泰语", Hindi: "印地语", Greek: "希腊语", Hebrew: "希伯来语",
+}
+
+// Name 返回语言的中文名称，未知的代码原样返回
+func Name(code string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// Code 将语言代码或中文名称 (如 ja、日语) 转为语言代码，无法识别时返回空字符串
+func Code(language string) string {
+	language = strings.TrimSpace(language)
+	if code := strings.ToLower(language); Supported(code) {
+		return code
+	}
+	for code, name := range names {
+		if name == language {
+			return code
+		}
+	}
+	return ""
+}
+
+// Supported 判断是否能检测该语言
+func Supported(code string) bool {
+	_, ok := names[code]
+	return ok
+}
+
+// cjkWeight 一个汉字、假名或谚文携带的信息量大致相当于几个拉丁字母，
+// 中文夹杂英文单词时按字符数直接比较会误判为英语
+const cjkWeight = 3
+
+type script int
+
+const (
+	scriptOther script = iota
+	scriptHan
+	scriptKana
+	scriptHangul
+	scriptLatin
+	scriptCyrillic
+	scriptArabic
+	scriptThai
+	scriptDevanagari
+	scriptGreek
+	scriptHebrew
+)
+
+// scriptLanguages 只对应一种常用语言的文字
+var scriptLanguages = map[script]string{
+	scriptHan:        Chinese,
+	scriptHangul:     Korean,
+	scriptArabic:     Arabic,
+	scriptThai:       Thai,
+	scriptDevanagari: Hindi,
+	scriptGreek:      Greek,
+	scriptHebrew:     Hebrew,
+}
+
+// Detect 检测文本的语言，返回语言代码，无法判断时返回空字符串。
+// 先按文字 (书写系统) 判断，拉丁字母与西里尔字母再按字母特征与三字母组 (trigram) 区分具体语言
+func Detect(text string) string {
+	counts := make(map[script]int)
+	for _, r := range text {
+		if sc := scriptOf(r); sc != scriptOther {
+			counts[sc]++
+		}
+	}
+
+	// 日文中的汉字往往多于假名，只要有一定比例的假名就判断为日语
+	if kana := counts[scriptKana]; kana > 0 && kana*10 >= counts[scriptHan]+kana {
+		return Japanese
+	}
+	counts[scriptHan] += counts[scriptKana]
+	delete(counts, scriptKana)
+
+	best, bestScore := scriptOther, 0
+	for sc, n := range counts {
+		score := n
+		if sc == scriptHan || sc == scriptHangul {
+			score *= cjkWeight
+		}
+		if score > bestScore || (score == bestScore && sc < best) {
+			best, bestScore = sc, score
+		}
+	}
+
+	switch best {
+	case scriptOther:
+		return ""
+	case scriptLatin:
+		return detectLatin(text)
+	case scriptCyrillic:
+		// 乌克兰语特有的字母
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return Ukrainian
+		}
+		return Russian
+	}
+	return scriptLanguages[best]
+}
+
+func scriptOf(r rune) script {
+	switch {
+	case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r), r == 'ー':
+		// 长音符号 ー 属于 Common，按假名处理
+		return scriptKana
+	case unicode.Is(unicode.Han, r):
+		return scriptHan
+	case unicode.Is(unicode.Hangul, r):
+		return scriptHangul
+	case unicode.Is(unicode.Latin, r):
+		return scriptLatin
+	case unicode.Is(unicode.Cyrillic, r):
+		return scriptCyrillic
+	case unicode.Is(unicode.Arabic, r):
+		return scriptArabic
+	case unicode.Is(unicode.Thai, r):
+		return scriptThai
+	case unicode.Is(unicode.Devanagari, r):
+		return scriptDevanagari
+	case unicode.Is(unicode.Greek, r):
+		return scriptGreek
+	case unicode.Is(unicode.Hebrew, r):
+		return scriptHebrew
+	}
+	return scriptOther
+}
@@ -0,0 +1,66 @@
+package langdetect
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"chinese", "今天天气很好，我们去公园散步吧。", Chinese},
+		{"chinese with english words", "帮我看看这个 API 的 error message 是什么意思", Chinese},
+		{"japanese with kanji", "今日は天気がいいので、公園を散歩しましょう。", Japanese},
+		{"katakana long vowel", "コーヒー", Japanese},
+		{"korean", "오늘 날씨가 정말 좋네요.", Korean},
+		{"english", "I think that the weather is going to be nice today.", English},
+		{"french", "Je pense que les enfants sont dans la maison avec leur mère.", French},
+		{"german", "Ich weiß nicht, ob er heute in die Stadt fährt.", German},
+		{"spanish", "¿Dónde está la estación de tren más cercana?", Spanish},
+		{"italian", "Non so se lui è già arrivato alla stazione per il treno.", Italian},
+		{"portuguese", "Não sei se ele já chegou à estação para pegar o trem.", Portuguese},
+		{"russian", "Я не знаю, когда он вернётся домой.", Russian},
+		{"ukrainian", "Я не знаю, коли він повернеться додому, їжа вже готова.", Ukrainian},
+		{"arabic", "أنا أحب تعلم اللغات الجديدة", Arabic},
+		{"thai", "วันนี้อากาศดีมาก", Thai},
+		{"hindi", "मुझे नई भाषाएँ सीखना पसंद है", Hindi},
+		{"greek", "Σήμερα ο καιρός είναι πολύ καλός", Greek},
+		{"hebrew", "אני אוהב ללמוד שפות חדשות", Hebrew},
+		{"empty", "", ""},
+		{"digits and punctuation", "12345 !?... 😀", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.text); got != tt.want {
+				t.Fatalf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ja", Japanese},
+		{" EN ", English},
+		{"日语", Japanese},
+		{"中文", Chinese},
+		{"klingon", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Code(tt.in); got != tt.want {
+			t.Errorf("Code(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestName(t *testing.T) {
+	if got := Name(Russian); got != "俄语" {
+		t.Fatalf("Name(ru) = %q", got)
+	}
+	if got := Name("xx"); got != "xx" {
+		t.Fatalf("unknown codes should be returned as is, got %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package langdetect
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinProfiles 各语言最常见的三字母组，按频率从高到低排列，_ 表示词边界
+var latinProfiles = map[string]string{
+	English:    "_th the he_ ed_ _an nd_ and _of of_ _to ing ng_ _in er_ is_ to_ in_ at_ es_ on_ ion _is tio you _yo ou_ _it it_ hat tha _ha for _fo or_ _wh ent ly_ are _be re_ _we",
+	French:     "_de de_ es_ _le le_ ent _la la_ nt_ _et et_ les ion _co re_ _pa on_ que ue_ _qu tio _un des _da ans _en en_ our ous _po _es est st_ _vo vou ait ai_ _ce _je _ne eau",
+	German:     "en_ er_ _de der ie_ ich ein die _di sch _ei che ch_ nd_ und _un den cht _da gen ine te_ ten _ge _in in_ _zu ist st_ _is nic ht_ das as_ _ni _ic eit ung ng_ _si _au",
+	Spanish:    "_de de_ os_ _la la_ es_ as_ _qu que ue_ _el el_ _en en_ ent _co ión _lo ado _se _un do_ _po ara _pa con est _es los ien _no par nte cio aci _me _ha _y_ ero",
+	Italian:    "_di di_ _ch che he_ _la la_ _il il_ re_ to_ _de ell _co one ne_ _in are zio ion _pe per er_ lla _un no_ ato ta_ _no non on_ _si _so nte ent gli _gl ere _è_ _e_",
+	Portuguese: "_de de_ os_ _qu que ue_ _a_ _o_ _co do_ da_ _da _do ão_ ção _se _pa ent _em em_ nte _na não _nã com _es est ra_ ara par _um um_ ado men _po as_ uma ar_ ões",
+}
+
+// letterHints 只在个别语言中出现的字母，每出现一次额外加分
+var letterHints = map[rune]string{
+	'ß': German, 'ä': German, 'ö': German, 'ü': German,
+	'ñ': Spanish, '¿': Spanish, '¡': Spanish,
+	'ã': Portuguese, 'õ': Portuguese,
+	'œ': French, 'ê': French, 'î': French, 'û': French, 'ë': French,
+	'ì': Italian, 'ò': Italian,
+}
+
+// hintWeight 特征字母的分值，相当于一个高频三字母组
+const hintWeight = 20
+
+type profile map[string]int
+
+var trigramProfiles = buildProfiles()
+
+func buildProfiles() map[string]profile {
+	profiles := make(map[string]profile, len(latinProfiles))
+	for lang, list := range latinProfiles {
+		grams := strings.Fields(list)
+		p := make(profile, len(grams))
+		for rank, gram := range grams {
+			// 排名越靠前的三字母组权重越高
+			p[strings.ReplaceAll(gram, "_", " ")] = len(grams) - rank
+		}
+		profiles[lang] = p
+	}
+	return profiles
+}
+
+// detectLatin 按三字母组频率区分使用拉丁字母的语言，没有任何特征时返回空字符串
+func detectLatin(text string) string {
+	scores := make(map[string]int, len(trigramProfiles))
+	for _, r := range strings.ToLower(text) {
+		if lang, ok := letterHints[r]; ok {
+			scores[lang] += hintWeight
+		}
+	}
+	for _, gram := range trigrams(text) {
+		for lang, p := range trigramProfiles {
+			scores[lang] += p[gram]
+		}
+	}
+
+	best, bestScore := "", 0
+	for lang, score := range scores {
+		if score > bestScore || (score == bestScore && lang < best) {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
+
+// trigrams 将文本按单词切分，在每个单词两端补上空格后取所有三字母组
+func trigrams(text string) []string {
+	var grams []string
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
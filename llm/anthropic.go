@@ -0,0 +1,237 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+// AnthropicOptions Anthropic Messages API 的连接参数
+type AnthropicOptions struct {
+	APIURL string
+	APIKey string
+	Model  string
+}
+
+// Anthropic Anthropic Messages API (/v1/messages) 后端
+type Anthropic struct {
+	opts AnthropicOptions
+}
+
+// NewAnthropic 创建 Anthropic 后端
+func NewAnthropic(opts AnthropicOptions) *Anthropic {
+	return &Anthropic{opts: opts}
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Stream        bool               `json:"stream,omitempty"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string                 `json:"role"`
+	Content []anthropicContentPart `json:"content"`
+}
+
+type anthropicContentPart struct {
+	Type   string                `json:"type"`
+	Text   string                `json:"text,omitempty"`
+	Source *anthropicImageSource `json:"source,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *Anthropic) Name() string { return "anthropic" }
+
+func (p *Anthropic) SupportsVision() bool { return true }
+
+func (p *Anthropic) Model() string { return p.opts.Model }
+
+func (p *Anthropic) Chat(ctx context.Context, req *Request) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(httpClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var anthropicResp anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&anthropicResp); err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, part := range anthropicResp.Content {
+		if part.Type == "text" {
+			text.WriteString(part.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+	return text.String(), nil
+}
+
+func (p *Anthropic) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(streamHTTPClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	err = readSSE(resp.Body, func(_, data string) (bool, error) {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return false, nil
+		}
+
+		switch event.Type {
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				full.WriteString(event.Delta.Text)
+				if onDelta != nil {
+					onDelta(event.Delta.Text)
+				}
+			}
+		case "message_stop":
+			return true, nil
+		case "error":
+			return true, fmt.Errorf("%s: %s", event.Error.Type, event.Error.Message)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", fmt.Errorf("no response from Anthropic")
+	}
+	return full.String(), nil
+}
+
+func (p *Anthropic) newRequest(ctx context.Context, req *Request, stream bool) (*http.Request, error) {
+	apiURL := fmt.Sprintf("%s/v1/messages", p.opts.APIURL)
+	model := req.Model
+	if model == "" {
+		model = p.opts.Model
+	}
+
+	if strings.TrimSpace(p.opts.APIKey) == "" {
+		return nil, fmt.Errorf("anthropic api key not set")
+	}
+	if strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("anthropic model not set")
+	}
+
+	// Anthropic 的 system prompt 是独立字段，不能出现在 messages 中
+	var system []string
+	var messages []anthropicMessage
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			if m.Content != "" {
+				system = append(system, m.Content)
+			}
+			continue
+		}
+		messages = append(messages, toAnthropicMessage(m))
+	}
+	// Messages API 没有 JSON 输出模式，改为在 system prompt 中要求
+	if req.Params.ResponseFormat == ResponseFormatJSON {
+		system = append(system, jsonOutputInstruction)
+	}
+
+	maxTokens := req.Params.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = anthropicDefaultMaxTokens
+	}
+	requestBody, err := json.Marshal(anthropicRequest{
+		Model:         model,
+		System:        strings.Join(system, "\n\n"),
+		Messages:      messages,
+		MaxTokens:     maxTokens,
+		Stream:        stream,
+		Temperature:   req.Params.Temperature,
+		TopP:          req.Params.TopP,
+		StopSequences: req.Params.Stop,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", p.opts.APIKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	return httpReq, nil
+}
+
+func toAnthropicMessage(m Message) anthropicMessage {
+	var parts []anthropicContentPart
+	for _, img := range m.Images {
+		parts = append(parts, anthropicContentPart{
+			Type: "image",
+			Source: &anthropicImageSource{
+				Type:      "base64",
+				MediaType: img.MIMEType,
+				Data:      base64.StdEncoding.EncodeToString(img.Data),
+			},
+		})
+	}
+	if m.Content != "" || len(parts) == 0 {
+		parts = append(parts, anthropicContentPart{Type: "text", Text: m.Content})
+	}
+	return anthropicMessage{Role: m.Role, Content: parts}
+}
@@ -0,0 +1,73 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError 后端返回的非 2xx 响应
+type APIError struct {
+	Provider   string
+	StatusCode int
+	RetryAfter time.Duration // 来自 Retry-After 响应头，未提供时为 0
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s api error: status %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+// Retryable 限流 (429)、超时 (408) 与服务端错误 (5xx) 可以重试或切换后端
+func (e *APIError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+func newAPIError(provider string, resp *http.Response, bodyBytes []byte) *APIError {
+	bodyText := strings.TrimSpace(string(bodyBytes))
+	if len(bodyText) > 2000 {
+		bodyText = bodyText[:2000]
+	}
+	return &APIError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       bodyText,
+	}
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数与 HTTP 日期两种格式
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// isRetryable 判断错误是否值得重试：上下文取消不重试，4xx (除 408/429) 说明请求本身有问题也不重试，
+// 其余网络错误与解析失败等视为临时故障
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Retryable()
+	}
+	return true
+}
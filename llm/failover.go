@@ -0,0 +1,293 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"tg-bot-go/logger"
+	"time"
+)
+
+// FailoverOptions 重试与熔断参数
+type FailoverOptions struct {
+	MaxRetries       int           // 每个后端的最大重试次数 (不含首次请求)
+	BaseBackoff      time.Duration // 指数退避的初始间隔
+	MaxBackoff       time.Duration // 单次等待的上限，Retry-After 超过该值时直接切换到下一个后端
+	BreakerThreshold int           // 连续失败多少次后熔断
+	BreakerCooldown  time.Duration // 熔断持续时间，到期后放行一次试探请求
+}
+
+// Target 故障转移链中的一个节点，Model 为空时使用请求或后端的默认模型
+type Target struct {
+	Provider Provider
+	Model    string
+}
+
+// Failover 按顺序尝试多个后端，每个后端带抖动退避重试，连续失败的后端会被暂时熔断跳过
+type Failover struct {
+	name     string
+	targets  []Target
+	opts     FailoverOptions
+	breakers *Breakers
+}
+
+// NewFailover 创建故障转移后端，breakers 可在多个 Failover 之间共享以合并同一后端的熔断状态
+func NewFailover(name string, opts FailoverOptions, breakers *Breakers, targets ...Target) *Failover {
+	if breakers == nil {
+		breakers = NewBreakers(opts.BreakerThreshold, opts.BreakerCooldown)
+	}
+	return &Failover{
+		name:     name,
+		targets:  targets,
+		opts:     opts,
+		breakers: breakers,
+	}
+}
+
+func (f *Failover) Name() string { return f.name }
+
+// Model 返回链中第一个节点的模型，正常情况下请求由它处理
+func (f *Failover) Model() string {
+	if len(f.targets) == 0 {
+		return ""
+	}
+	if model := f.targets[0].Model; model != "" {
+		return model
+	}
+	return ModelName(f.targets[0].Provider)
+}
+
+// SupportsVision 链中任一后端支持图片即可，带图片的请求只会发往支持的后端
+func (f *Failover) SupportsVision() bool {
+	for _, t := range f.targets {
+		if SupportsVision(t.Provider) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Failover) Chat(ctx context.Context, req *Request) (string, error) {
+	return f.run(ctx, req, func(p Provider, r *Request) (string, error) {
+		return p.Chat(ctx, r)
+	})
+}
+
+// ChatStream 已经向调用方输出过内容后不再重试或切换后端，避免同一条回复混入两次生成的内容
+func (f *Failover) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	return f.run(ctx, req, func(p Provider, r *Request) (string, error) {
+		emitted := false
+		streamer, ok := p.(Streamer)
+		if !ok {
+			text, err := p.Chat(ctx, r)
+			if err == nil && onDelta != nil {
+				emitted = true
+				onDelta(text)
+			}
+			return text, err
+		}
+		text, err := streamer.ChatStream(ctx, r, func(delta string) {
+			emitted = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		})
+		if err != nil && emitted {
+			return text, &interruptedError{err: err}
+		}
+		return text, err
+	})
+}
+
+// interruptedError 流式回复在输出过内容后中断
+type interruptedError struct{ err error }
+
+func (e *interruptedError) Error() string { return "stream interrupted: " + e.err.Error() }
+func (e *interruptedError) Unwrap() error { return e.err }
+
+func (f *Failover) run(ctx context.Context, req *Request, call func(Provider, *Request) (string, error)) (string, error) {
+	var errs []string
+	needVision := req.HasImages()
+
+	for _, t := range f.targets {
+		key := breakerKey(t)
+		if needVision && !SupportsVision(t.Provider) {
+			continue
+		}
+		if !f.breakers.Allow(key) {
+			logger.LogAPI(fmt.Sprintf("[%s] skip %s: circuit open", f.name, key))
+			errs = append(errs, fmt.Sprintf("%s: circuit open", key))
+			continue
+		}
+
+		attemptReq := *req
+		if t.Model != "" {
+			attemptReq.Model = t.Model
+		}
+
+		for attempt := 0; attempt <= f.opts.MaxRetries; attempt++ {
+			start := time.Now()
+			text, err := call(t.Provider, &attemptReq)
+			if err == nil {
+				f.breakers.Success(key)
+				logger.LogAPI(fmt.Sprintf("[%s] %s attempt %d ok in %v", f.name, key, attempt+1, time.Since(start).Round(time.Millisecond)))
+				return text, nil
+			}
+
+			logger.LogAPI(fmt.Sprintf("[%s] %s attempt %d failed in %v: %v", f.name, key, attempt+1, time.Since(start).Round(time.Millisecond), err))
+			var interrupted *interruptedError
+			if errors.As(err, &interrupted) {
+				// 已经输出过内容，不再退避重试或切换后端，直接返回原始错误
+				switch {
+				case ctx.Err() != nil:
+					f.breakers.Abort(key)
+				case isRetryable(interrupted.err):
+					f.breakers.Failure(key)
+				default:
+					f.breakers.Success(key)
+				}
+				return text, fmt.Errorf("%s: %s: %w", f.name, key, interrupted.err)
+			}
+			if ctx.Err() != nil {
+				// 请求被取消，不能说明后端是否可用
+				f.breakers.Abort(key)
+				return "", ctx.Err()
+			}
+			if !isRetryable(err) {
+				// 后端可用但拒绝了请求，不计入熔断；不同后端的参数要求不同，仍继续尝试下一个
+				f.breakers.Success(key)
+				errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+				break
+			}
+			f.breakers.Failure(key)
+
+			if attempt == f.opts.MaxRetries || !f.breakers.Allow(key) {
+				errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+				break
+			}
+			wait, ok := f.backoff(attempt, err)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+				break
+			}
+			select {
+			case <-ctx.Done():
+				f.breakers.Abort(key)
+				return "", ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return "", fmt.Errorf("%s: no available provider", f.name)
+	}
+	return "", fmt.Errorf("%s: all providers failed: %s", f.name, strings.Join(errs, "; "))
+}
+
+// backoff 计算下一次重试前的等待时间 (full jitter)，Retry-After 超过上限时返回 false 表示放弃该后端
+func (f *Failover) backoff(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > f.opts.MaxBackoff {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	backoff := f.opts.BaseBackoff << attempt
+	if backoff <= 0 || backoff > f.opts.MaxBackoff {
+		backoff = f.opts.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1), true
+}
+
+func breakerKey(t Target) string {
+	if t.Model == "" {
+		return t.Provider.Name()
+	}
+	return t.Provider.Name() + "/" + t.Model
+}
+
+// Breakers 按后端维护的熔断器集合
+type Breakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu     sync.Mutex
+	states map[string]*breakerState
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// NewBreakers 创建熔断器集合，threshold <= 0 时不熔断
+func NewBreakers(threshold int, cooldown time.Duration) *Breakers {
+	return &Breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		states:    make(map[string]*breakerState),
+	}
+}
+
+// Allow 判断是否可以请求该后端；熔断到期后只放行一个试探请求 (half-open)
+func (b *Breakers) Allow(key string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.states[key]
+	if !ok || s.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(s.openUntil) || s.probing {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+// Success 请求成功后重置熔断状态
+func (b *Breakers) Success(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.states, key)
+}
+
+// Abort 请求被取消时释放试探名额，不计入失败，下一个请求可以重新试探
+func (b *Breakers) Abort(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s, ok := b.states[key]; ok {
+		s.probing = false
+	}
+}
+
+// Failure 记录一次失败，连续失败达到阈值时打开熔断
+func (b *Breakers) Failure(key string) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s, ok := b.states[key]
+	if !ok {
+		s = &breakerState{}
+		b.states[key] = s
+	}
+	s.failures++
+	s.probing = false
+	if s.failures >= b.threshold {
+		s.openUntil = time.Now().Add(b.cooldown)
+		logger.LogAPI(fmt.Sprintf("circuit opened for %s (%d consecutive failures, cooldown %v)", key, s.failures, b.cooldown))
+	}
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakersStateMachine(t *testing.T) {
+	b := NewBreakers(2, 20*time.Millisecond)
+
+	// 未达到阈值时一直放行
+	b.Failure("p")
+	if !b.Allow("p") {
+		t.Fatal("breaker opened before reaching threshold")
+	}
+
+	// 达到阈值后熔断
+	b.Failure("p")
+	if b.Allow("p") {
+		t.Fatal("breaker should be open after threshold failures")
+	}
+
+	// 冷却结束后只放行一个试探请求
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow("p") {
+		t.Fatal("half-open breaker should allow one probe")
+	}
+	if b.Allow("p") {
+		t.Fatal("half-open breaker allowed a second concurrent probe")
+	}
+
+	// 试探失败后重新熔断
+	b.Failure("p")
+	if b.Allow("p") {
+		t.Fatal("failed probe should reopen the breaker")
+	}
+
+	// 试探成功后恢复
+	time.Sleep(30 * time.Millisecond)
+	if !b.Allow("p") {
+		t.Fatal("expected probe after cooldown")
+	}
+	b.Success("p")
+	if !b.Allow("p") || !b.Allow("p") {
+		t.Fatal("breaker should be closed after a successful probe")
+	}
+}
+
+func TestBreakersAbortReleasesProbe(t *testing.T) {
+	b := NewBreakers(1, 10*time.Millisecond)
+	b.Failure("p")
+	time.Sleep(20 * time.Millisecond)
+
+	if !b.Allow("p") {
+		t.Fatal("expected probe after cooldown")
+	}
+	b.Abort("p")
+	if !b.Allow("p") {
+		t.Fatal("aborted probe should let the next request probe again")
+	}
+}
+
+func TestBreakersDisabled(t *testing.T) {
+	b := NewBreakers(0, time.Minute)
+	for i := 0; i < 5; i++ {
+		b.Failure("p")
+	}
+	if !b.Allow("p") {
+		t.Fatal("breaker with threshold 0 should never open")
+	}
+}
+
+// stubProvider 每次调用的结果由 call 决定
+type stubProvider struct {
+	name  string
+	calls int
+	call  func(ctx context.Context) error
+}
+
+func (p *stubProvider) Name() string { return p.name }
+
+func (p *stubProvider) Chat(ctx context.Context, req *Request) (string, error) {
+	p.calls++
+	if err := p.call(ctx); err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+func TestFailoverCancelledProbeDoesNotWedgeBreaker(t *testing.T) {
+	breakers := NewBreakers(1, 10*time.Millisecond)
+	breakers.Failure("stub")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &stubProvider{name: "stub", call: func(context.Context) error {
+		cancel()
+		return context.Canceled
+	}}
+	f := NewFailover("test", FailoverOptions{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, breakers, Target{Provider: provider})
+
+	if _, err := f.Chat(ctx, &Request{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	provider.call = func(context.Context) error { return nil }
+	text, err := f.Chat(context.Background(), &Request{})
+	if err != nil || text != "ok" {
+		t.Fatalf("provider should be probed again after a cancelled probe, got %q, %v", text, err)
+	}
+}
+
+func TestFailoverFallsBackToNextTarget(t *testing.T) {
+	first := &stubProvider{name: "first", call: func(context.Context) error {
+		return &APIError{Provider: "first", StatusCode: 503}
+	}}
+	second := &stubProvider{name: "second", call: func(context.Context) error { return nil }}
+	f := NewFailover("test", FailoverOptions{MaxRetries: 1, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, BreakerThreshold: 5}, nil,
+		Target{Provider: first}, Target{Provider: second})
+
+	text, err := f.Chat(context.Background(), &Request{})
+	if err != nil || text != "ok" {
+		t.Fatalf("expected fallback to succeed, got %q, %v", text, err)
+	}
+	if first.calls != 2 || second.calls != 1 {
+		t.Fatalf("unexpected call counts: first=%d second=%d", first.calls, second.calls)
+	}
+}
+
+// stubStreamer 先输出 deltas，再返回 err
+type stubStreamer struct {
+	stubProvider
+	deltas []string
+	err    error
+}
+
+func (p *stubStreamer) ChatStream(ctx context.Context, req *Request, onDelta func(string)) (string, error) {
+	p.calls++
+	text := ""
+	for _, d := range p.deltas {
+		text += d
+		onDelta(d)
+	}
+	return text, p.err
+}
+
+func TestFailoverStreamInterruptedDoesNotTouchNextTarget(t *testing.T) {
+	breakers := NewBreakers(1, 10*time.Millisecond)
+	// 第二个后端处于半开状态，下一个请求会占用试探名额
+	breakers.Failure("second")
+	time.Sleep(20 * time.Millisecond)
+
+	upstream := &APIError{Provider: "first", StatusCode: 502}
+	first := &stubStreamer{stubProvider: stubProvider{name: "first"}, deltas: []string{"partial"}, err: upstream}
+	second := &stubProvider{name: "second", call: func(context.Context) error { return nil }}
+	f := NewFailover("test", FailoverOptions{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, breakers,
+		Target{Provider: first}, Target{Provider: second})
+
+	var out string
+	text, err := f.ChatStream(context.Background(), &Request{}, func(d string) { out += d })
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr != upstream {
+		t.Fatalf("expected the upstream error, got %v", err)
+	}
+	if text != "partial" || out != "partial" {
+		t.Fatalf("unexpected output %q / %q", text, out)
+	}
+	if first.calls != 1 || second.calls != 0 {
+		t.Fatalf("interrupted stream should not be retried or failed over: first=%d second=%d", first.calls, second.calls)
+	}
+	// 第二个后端的试探名额没有被占用
+	if !breakers.Allow("second") {
+		t.Fatal("half-open breaker of the next target should still allow a probe")
+	}
+	// 中断计入第一个后端的失败
+	if breakers.Allow("first") {
+		t.Fatal("interrupted stream should count as a failure of its backend")
+	}
+}
@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GeminiOptions Google Gemini API 的连接参数
+type GeminiOptions struct {
+	APIURL string
+	APIKey string
+	Model  string
+}
+
+// Gemini Google Gemini generateContent 后端
+type Gemini struct {
+	opts GeminiOptions
+}
+
+// NewGemini 创建 Gemini 后端
+func NewGemini(opts GeminiOptions) *Gemini {
+	return &Gemini{opts: opts}
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  int      `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	ResponseMimeType string   `json:"responseMimeType,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text       string            `json:"text,omitempty"`
+	InlineData *geminiInlineData `json:"inline_data,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func (p *Gemini) Name() string { return "gemini" }
+
+func (p *Gemini) SupportsVision() bool { return true }
+
+func (p *Gemini) Model() string { return p.opts.Model }
+
+func (p *Gemini) Chat(ctx context.Context, req *Request) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(httpClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var geminiResp geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&geminiResp); err != nil {
+		return "", err
+	}
+	if geminiResp.Error != nil {
+		return "", fmt.Errorf("%s: %s", geminiResp.Error.Status, geminiResp.Error.Message)
+	}
+
+	text := geminiResp.text()
+	if text == "" {
+		return "", fmt.Errorf("no response from Gemini")
+	}
+	return text, nil
+}
+
+func (p *Gemini) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(streamHTTPClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	err = readSSE(resp.Body, func(_, data string) (bool, error) {
+		var chunk geminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, nil
+		}
+		if chunk.Error != nil {
+			return true, fmt.Errorf("%s: %s", chunk.Error.Status, chunk.Error.Message)
+		}
+		if delta := chunk.text(); delta != "" {
+			full.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", fmt.Errorf("no response from Gemini")
+	}
+	return full.String(), nil
+}
+
+func (p *Gemini) newRequest(ctx context.Context, req *Request, stream bool) (*http.Request, error) {
+	model := req.Model
+	if model == "" {
+		model = p.opts.Model
+	}
+
+	if strings.TrimSpace(p.opts.APIKey) == "" {
+		return nil, fmt.Errorf("gemini api key not set")
+	}
+	if strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("gemini model not set")
+	}
+
+	apiURL := fmt.Sprintf("%s/v1beta/models/%s:generateContent", p.opts.APIURL, model)
+	if stream {
+		apiURL = fmt.Sprintf("%s/v1beta/models/%s:streamGenerateContent?alt=sse", p.opts.APIURL, model)
+	}
+
+	var body geminiRequest
+	var system []geminiPart
+	for _, m := range req.Messages {
+		if m.Role == "system" {
+			if m.Content != "" {
+				system = append(system, geminiPart{Text: m.Content})
+			}
+			continue
+		}
+		body.Contents = append(body.Contents, toGeminiContent(m))
+	}
+	if len(system) > 0 {
+		body.SystemInstruction = &geminiContent{Parts: system}
+	}
+	if params := req.Params; !params.IsZero() {
+		body.GenerationConfig = &geminiGenerationConfig{
+			Temperature:     params.Temperature,
+			TopP:            params.TopP,
+			MaxOutputTokens: params.MaxTokens,
+			StopSequences:   params.Stop,
+		}
+		if params.ResponseFormat == ResponseFormatJSON {
+			body.GenerationConfig.ResponseMimeType = "application/json"
+		}
+	}
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", p.opts.APIKey)
+	return httpReq, nil
+}
+
+// Gemini 中助手角色名为 model
+func toGeminiContent(m Message) geminiContent {
+	role := m.Role
+	if role == "assistant" {
+		role = "model"
+	}
+
+	var parts []geminiPart
+	for _, img := range m.Images {
+		parts = append(parts, geminiPart{InlineData: &geminiInlineData{
+			MimeType: img.MIMEType,
+			Data:     base64.StdEncoding.EncodeToString(img.Data),
+		}})
+	}
+	if m.Content != "" || len(parts) == 0 {
+		parts = append(parts, geminiPart{Text: m.Content})
+	}
+	return geminiContent{Role: role, Parts: parts}
+}
+
+func (r *geminiResponse) text() string {
+	if len(r.Candidates) == 0 {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range r.Candidates[0].Content.Parts {
+		text.WriteString(part.Text)
+	}
+	return text.String()
+}
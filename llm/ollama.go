@@ -0,0 +1,185 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OllamaOptions 本地 Ollama 服务的连接参数
+type OllamaOptions struct {
+	APIURL string
+	Model  string
+	Vision bool // 模型是否支持图片输入 (如 llava)
+}
+
+// Ollama 本地 Ollama /api/chat 后端
+type Ollama struct {
+	opts OllamaOptions
+}
+
+// NewOllama 创建 Ollama 后端
+func NewOllama(opts OllamaOptions) *Ollama {
+	return &Ollama{opts: opts}
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   string          `json:"format,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role    string   `json:"role"`
+	Content string   `json:"content"`
+	Images  []string `json:"images,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message ollamaMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error"`
+}
+
+func (p *Ollama) Name() string { return "ollama" }
+
+func (p *Ollama) SupportsVision() bool { return p.opts.Vision }
+
+func (p *Ollama) Model() string { return p.opts.Model }
+
+func (p *Ollama) Chat(ctx context.Context, req *Request) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(httpClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var ollamaResp ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
+		return "", err
+	}
+	if ollamaResp.Error != "" {
+		return "", fmt.Errorf(ollamaResp.Error)
+	}
+	if ollamaResp.Message.Content == "" {
+		return "", fmt.Errorf("no response from Ollama")
+	}
+	return ollamaResp.Message.Content, nil
+}
+
+// ChatStream Ollama 的流式响应是逐行的 JSON (NDJSON)，而非 SSE
+func (p *Ollama) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(streamHTTPClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return full.String(), fmt.Errorf(chunk.Error)
+		}
+		if delta := chunk.Message.Content; delta != "" {
+			full.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", fmt.Errorf("no response from Ollama")
+	}
+	return full.String(), nil
+}
+
+func (p *Ollama) newRequest(ctx context.Context, req *Request, stream bool) (*http.Request, error) {
+	apiURL := fmt.Sprintf("%s/api/chat", p.opts.APIURL)
+	model := req.Model
+	if model == "" {
+		model = p.opts.Model
+	}
+
+	if strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("ollama model not set")
+	}
+
+	messages := make([]ollamaMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg := ollamaMessage{Role: m.Role, Content: m.Content}
+		for _, img := range m.Images {
+			msg.Images = append(msg.Images, base64.StdEncoding.EncodeToString(img.Data))
+		}
+		messages = append(messages, msg)
+	}
+
+	body := ollamaRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   stream,
+	}
+	if params := req.Params; !params.IsZero() {
+		body.Options = &ollamaOptions{
+			Temperature: params.Temperature,
+			TopP:        params.TopP,
+			NumPredict:  params.MaxTokens,
+			Stop:        params.Stop,
+		}
+		if params.ResponseFormat == ResponseFormatJSON {
+			body.Format = "json"
+		}
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return httpReq, nil
+}
@@ -0,0 +1,252 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OpenAIOptions OpenAI 兼容接口（OpenAI、OpenRouter 等）的连接参数
+type OpenAIOptions struct {
+	APIURL      string
+	APIKey      string
+	Model       string
+	HTTPReferer string
+	XTitle      string
+}
+
+// OpenAI OpenAI 兼容的 /v1/chat/completions 后端
+type OpenAI struct {
+	opts OpenAIOptions
+}
+
+// NewOpenAI 创建 OpenAI 兼容后端
+func NewOpenAI(opts OpenAIOptions) *OpenAI {
+	return &OpenAI{opts: opts}
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []openAIMessage       `json:"messages"`
+	Stream         bool                  `json:"stream,omitempty"`
+	Temperature    *float64              `json:"temperature,omitempty"`
+	TopP           *float64              `json:"top_p,omitempty"`
+	MaxTokens      int                   `json:"max_tokens,omitempty"`
+	Stop           []string              `json:"stop,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+// openAIMessage 纯文本消息的 content 为字符串，多模态消息为 content part 数组
+type openAIMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// openAIStreamChunk 流式响应中每个 SSE data 事件的结构
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+func (p *OpenAI) Name() string { return "openai" }
+
+func (p *OpenAI) SupportsVision() bool { return true }
+
+func (p *OpenAI) Model() string { return p.opts.Model }
+
+// Chat gets a response from OpenAI based on the provided messages history
+func (p *OpenAI) Chat(ctx context.Context, req *Request) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := doJSON(httpClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var openAIResp openAIChatResponse
+	if err := json.Unmarshal(bodyBytes, &openAIResp); err != nil {
+		return "", err
+	}
+
+	if len(openAIResp.Choices) > 0 {
+		return openAIResp.Choices[0].Message.Content, nil
+	}
+
+	var openAIError openAIErrorResponse
+	if err := json.Unmarshal(bodyBytes, &openAIError); err == nil && openAIError.Error.Message != "" {
+		return "", fmt.Errorf(openaiErrorMessage(openAIError))
+	}
+
+	return "", fmt.Errorf("no response from OpenAI")
+}
+
+// ChatStream 以 stream 模式请求，每收到一段增量内容就调用 onDelta，结束后返回完整的回复文本
+func (p *OpenAI) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	httpReq, err := p.newRequest(ctx, req, true)
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := doJSON(streamHTTPClient, httpReq, p.Name())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var full strings.Builder
+	err = readSSE(resp.Body, func(_, data string) (bool, error) {
+		if data == "[DONE]" {
+			return true, nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil || len(chunk.Choices) == 0 {
+			// 流中途出错时服务端会以 data 事件返回 error 对象
+			var openAIError openAIErrorResponse
+			if json.Unmarshal([]byte(data), &openAIError) == nil && openAIError.Error.Message != "" {
+				return true, fmt.Errorf(openaiErrorMessage(openAIError))
+			}
+			return false, nil
+		}
+
+		if delta := chunk.Choices[0].Delta.Content; delta != "" {
+			full.WriteString(delta)
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return full.String(), err
+	}
+
+	if full.Len() == 0 {
+		return "", fmt.Errorf("no response from OpenAI")
+	}
+	return full.String(), nil
+}
+
+// newRequest 构建 /v1/chat/completions 请求
+func (p *OpenAI) newRequest(ctx context.Context, req *Request, stream bool) (*http.Request, error) {
+	apiURL := fmt.Sprintf("%s/v1/chat/completions", p.opts.APIURL)
+	model := req.Model
+	if model == "" {
+		model = p.opts.Model
+	}
+
+	if strings.TrimSpace(p.opts.APIKey) == "" {
+		return nil, fmt.Errorf("openai api key not set")
+	}
+	if strings.TrimSpace(model) == "" {
+		return nil, fmt.Errorf("openai model not set")
+	}
+
+	messages := make([]openAIMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		messages = append(messages, toOpenAIMessage(m))
+	}
+
+	// 构建请求体
+	body := openAIChatRequest{
+		Model:       model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+		MaxTokens:   req.Params.MaxTokens,
+		Stop:        req.Params.Stop,
+	}
+	if req.Params.ResponseFormat == ResponseFormatJSON {
+		body.ResponseFormat = &openAIResponseFormat{Type: "json_object"}
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.opts.APIKey))
+	if ref := p.opts.HTTPReferer; ref != "" {
+		httpReq.Header.Set("HTTP-Referer", ref)
+	}
+	if title := p.opts.XTitle; title != "" {
+		httpReq.Header.Set("X-Title", title)
+	}
+	return httpReq, nil
+}
+
+func toOpenAIMessage(m Message) openAIMessage {
+	if len(m.Images) == 0 {
+		return openAIMessage{Role: m.Role, Content: m.Content}
+	}
+
+	var parts []openAIContentPart
+	if m.Content != "" {
+		parts = append(parts, openAIContentPart{Type: "text", Text: m.Content})
+	}
+	for _, img := range m.Images {
+		dataURL := fmt.Sprintf("data:%s;base64,%s", img.MIMEType, base64.StdEncoding.EncodeToString(img.Data))
+		parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: dataURL}})
+	}
+	return openAIMessage{Role: m.Role, Content: parts}
+}
+
+func openaiErrorMessage(openAIError openAIErrorResponse) string {
+	if openAIError.Error.Type != "" {
+		return fmt.Sprintf("%s: %s", openAIError.Error.Type, openAIError.Error.Message)
+	}
+	return openAIError.Error.Message
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message 与具体后端无关的对话消息
+type Message struct {
+	Role    string  `json:"role"`
+	Content string  `json:"content"`
+	Images  []Image `json:"images,omitempty"`
+}
+
+// Image 多模态请求中的图片内容
+type Image struct {
+	MIMEType string `json:"mime_type"`
+	Data     []byte `json:"data"`
+}
+
+// Request 一次对话补全请求
+type Request struct {
+	Model    string // 为空时使用 Provider 的默认模型
+	Messages []Message
+	Params   Params
+}
+
+// ResponseFormatJSON 要求模型只输出 JSON 对象
+const ResponseFormatJSON = "json"
+
+// jsonOutputInstruction 不支持 JSON 输出模式的后端通过 system prompt 要求
+const jsonOutputInstruction = "Respond with a single valid JSON object only, without any surrounding text or code fences."
+
+// Params 生成参数，零值表示使用后端的默认值
+type Params struct {
+	Temperature    *float64
+	TopP           *float64
+	MaxTokens      int
+	Stop           []string
+	ResponseFormat string // 为空或 text 时输出普通文本，json 时要求输出 JSON 对象
+}
+
+// IsZero 判断是否未设置任何参数
+func (p Params) IsZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.MaxTokens == 0 && len(p.Stop) == 0 && p.ResponseFormat == ""
+}
+
+// merge 用 defaults 补全未设置的参数
+func (p Params) merge(defaults Params) Params {
+	if p.Temperature == nil {
+		p.Temperature = defaults.Temperature
+	}
+	if p.TopP == nil {
+		p.TopP = defaults.TopP
+	}
+	if p.MaxTokens == 0 {
+		p.MaxTokens = defaults.MaxTokens
+	}
+	if p.Stop == nil {
+		p.Stop = defaults.Stop
+	}
+	if p.ResponseFormat == "" {
+		p.ResponseFormat = defaults.ResponseFormat
+	}
+	return p
+}
+
+// Provider 对话补全后端
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, req *Request) (string, error)
+}
+
+// Streamer 由支持流式输出的 Provider 实现，每收到一段增量内容就调用 onDelta
+type Streamer interface {
+	ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error)
+}
+
+// VisionCapable 由支持图片输入的 Provider 实现
+type VisionCapable interface {
+	SupportsVision() bool
+}
+
+// ModelNamer 由能报告默认模型的 Provider 实现，用于估算上下文窗口
+type ModelNamer interface {
+	Model() string
+}
+
+// ModelName 返回 Provider 默认使用的模型，未知时返回空字符串
+func ModelName(p Provider) string {
+	if m, ok := p.(ModelNamer); ok {
+		return m.Model()
+	}
+	return ""
+}
+
+// SupportsVision 判断 Provider 是否可以处理图片输入
+func SupportsVision(p Provider) bool {
+	v, ok := p.(VisionCapable)
+	return ok && v.SupportsVision()
+}
+
+// HasImages 判断请求中是否包含图片
+func (r *Request) HasImages() bool {
+	for _, m := range r.Messages {
+		if len(m.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var httpClient = &http.Client{
+	Timeout: 60 * time.Second,
+}
+
+// 流式请求持续时间较长，单独使用超时更宽松的客户端
+var streamHTTPClient = &http.Client{
+	Timeout: 5 * time.Minute,
+}
+
+// doJSON 发送请求并在状态码非 2xx 时返回 *APIError，调用方负责关闭响应体
+func doJSON(client *http.Client, req *http.Request, provider string) (*http.Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, newAPIError(provider, resp, bodyBytes)
+	}
+	return resp, nil
+}
+
+// readSSE 逐个读取 Server-Sent Events，fn 返回 true 时停止读取
+func readSSE(body io.Reader, fn func(event, data string) (bool, error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// 空行表示一个事件结束
+			if len(data) > 0 {
+				stop, err := fn(event, strings.Join(data, "\n"))
+				if err != nil || stop {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+		// 跳过注释（OpenRouter 会发送 ": OPENROUTER PROCESSING" 心跳）
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := fn(event, strings.Join(data, "\n"))
+		return err
+	}
+	return nil
+}
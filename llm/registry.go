@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"tg-bot-go/config"
+	"time"
+)
+
+// FallbackName 故障转移链在 Registry 中的名称
+const FallbackName = "fallback"
+
+// Registry 按名称管理已配置的后端
+type Registry struct {
+	providers   map[string]Provider
+	defaultName string
+}
+
+// NewRegistry 创建 Registry，defaultName 必须是已注册的后端
+func NewRegistry(defaultName string, providers ...Provider) (*Registry, error) {
+	r := &Registry{
+		providers:   make(map[string]Provider),
+		defaultName: defaultName,
+	}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	if _, ok := r.providers[defaultName]; !ok {
+		return nil, fmt.Errorf("default llm provider %q is not configured", defaultName)
+	}
+	return r, nil
+}
+
+// NewRegistryFromConfig 根据配置注册所有已填写凭据的后端
+func NewRegistryFromConfig(cfg config.Configuration) (*Registry, error) {
+	var providers []Provider
+	if cfg.OpenAI.APIKey != "" {
+		providers = append(providers, NewOpenAI(OpenAIOptions{
+			APIURL:      cfg.OpenAI.APIURL,
+			APIKey:      cfg.OpenAI.APIKey,
+			Model:       cfg.OpenAI.Model,
+			HTTPReferer: cfg.OpenAI.HTTPReferer,
+			XTitle:      cfg.OpenAI.XTitle,
+		}))
+	}
+	if cfg.Anthropic.APIKey != "" {
+		providers = append(providers, NewAnthropic(AnthropicOptions{
+			APIURL: cfg.Anthropic.APIURL,
+			APIKey: cfg.Anthropic.APIKey,
+			Model:  cfg.Anthropic.Model,
+		}))
+	}
+	if cfg.Gemini.APIKey != "" {
+		providers = append(providers, NewGemini(GeminiOptions{
+			APIURL: cfg.Gemini.APIURL,
+			APIKey: cfg.Gemini.APIKey,
+			Model:  cfg.Gemini.Model,
+		}))
+	}
+	if cfg.Ollama.Model != "" {
+		providers = append(providers, NewOllama(OllamaOptions{
+			APIURL: cfg.Ollama.APIURL,
+			Model:  cfg.Ollama.Model,
+			Vision: cfg.Ollama.Vision,
+		}))
+	}
+
+	// 每个后端都包一层重试与熔断，熔断状态在单个后端与故障转移链之间共享
+	opts := FailoverOptions{
+		MaxRetries:       cfg.LLM.MaxRetries,
+		BaseBackoff:      500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: cfg.LLM.BreakerThreshold,
+		BreakerCooldown:  cfg.LLM.BreakerCooldown,
+	}
+	breakers := NewBreakers(opts.BreakerThreshold, opts.BreakerCooldown)
+	byName := make(map[string]Provider, len(providers))
+	var wrapped []Provider
+	for _, p := range providers {
+		byName[p.Name()] = p
+		wrapped = append(wrapped, NewFailover(p.Name(), opts, breakers, Target{Provider: p}))
+	}
+
+	defaultName := cfg.LLM.Provider
+	if len(cfg.LLM.Fallback) > 0 {
+		var targets []Target
+		for _, entry := range cfg.LLM.Fallback {
+			name, model, _ := strings.Cut(entry, ":")
+			p, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("fallback llm provider %q is not configured", name)
+			}
+			targets = append(targets, Target{Provider: p, Model: model})
+		}
+		wrapped = append(wrapped, NewFailover(FallbackName, opts, breakers, targets...))
+		defaultName = FallbackName
+	}
+	return NewRegistry(defaultName, wrapped...)
+}
+
+// NewTranscriberFromConfig 根据配置创建语音转写后端，既未指定接口地址也没有凭据时返回 nil
+func NewTranscriberFromConfig(cfg config.Configuration) Transcriber {
+	if !cfg.Transcribe.Enabled {
+		return nil
+	}
+	return NewWhisper(WhisperOptions{
+		APIURL: cfg.Transcribe.APIURL,
+		APIKey: cfg.Transcribe.APIKey,
+		Model:  cfg.Transcribe.Model,
+	})
+}
+
+// Get 返回指定名称的后端，名称为空或未配置时返回默认后端
+func (r *Registry) Get(name string) Provider {
+	if p, ok := r.providers[name]; ok {
+		return p
+	}
+	return r.providers[r.defaultName]
+}
+
+// Has 判断是否注册了指定名称的后端
+func (r *Registry) Has(name string) bool {
+	_, ok := r.providers[name]
+	return ok
+}
+
+// Default 返回默认后端
+func (r *Registry) Default() Provider {
+	return r.providers[r.defaultName]
+}
+
+// Names 返回所有已注册后端的名称
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithDefaults 为请求填入默认的模型与生成参数，请求中已指定的值优先
+func WithDefaults(p Provider, model string, params Params) Provider {
+	if model == "" && params.IsZero() {
+		return p
+	}
+	return &defaulted{Provider: p, model: model, params: params}
+}
+
+type defaulted struct {
+	Provider
+	model  string
+	params Params
+}
+
+func (d *defaulted) apply(req *Request) *Request {
+	r := *req
+	if r.Model == "" {
+		r.Model = d.model
+	}
+	r.Params = r.Params.merge(d.params)
+	return &r
+}
+
+func (d *defaulted) Chat(ctx context.Context, req *Request) (string, error) {
+	return d.Provider.Chat(ctx, d.apply(req))
+}
+
+func (d *defaulted) ChatStream(ctx context.Context, req *Request, onDelta func(delta string)) (string, error) {
+	streamer, ok := d.Provider.(Streamer)
+	if !ok {
+		return d.Provider.Chat(ctx, d.apply(req))
+	}
+	return streamer.ChatStream(ctx, d.apply(req), onDelta)
+}
+
+func (d *defaulted) Model() string {
+	if d.model != "" {
+		return d.model
+	}
+	return ModelName(d.Provider)
+}
+
+func (d *defaulted) SupportsVision() bool {
+	return SupportsVision(d.Provider)
+}
@@ -0,0 +1,84 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Transcriber 语音转文字
+type Transcriber interface {
+	Transcribe(ctx context.Context, filename string, audio []byte) (string, error)
+}
+
+// WhisperOptions OpenAI 兼容的 /v1/audio/transcriptions 接口参数
+type WhisperOptions struct {
+	APIURL string
+	APIKey string
+	Model  string
+}
+
+// Whisper OpenAI 兼容的语音转写后端，APIURL 可指向本地的兼容服务
+type Whisper struct {
+	opts WhisperOptions
+}
+
+// NewWhisper 创建语音转写后端
+func NewWhisper(opts WhisperOptions) *Whisper {
+	return &Whisper{opts: opts}
+}
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+func (w *Whisper) Transcribe(ctx context.Context, filename string, audio []byte) (string, error) {
+	apiURL := fmt.Sprintf("%s/v1/audio/transcriptions", w.opts.APIURL)
+	if strings.TrimSpace(w.opts.Model) == "" {
+		return "", fmt.Errorf("transcription model not set")
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("model", w.opts.Model); err != nil {
+		return "", err
+	}
+	if err := form.WriteField("response_format", "json"); err != nil {
+		return "", err
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if w.opts.APIKey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", w.opts.APIKey))
+	}
+
+	resp, err := doJSON(streamHTTPClient, req, "transcription")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result transcriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(result.Text), nil
+}
@@ -5,34 +5,46 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"testing"
 )
 
+const logDir = "logs"
+
 var (
-	combinedLog *log.Logger
+	combinedLog  *log.Logger
+	combinedOnce sync.Once
 )
 
-func init() {
-	// 创建日志目录
-	if err := os.MkdirAll("logs", os.ModePerm); err != nil {
-		log.Fatalf("无法创建日志目录：%v", err)
-	}
-
-	// 初始化综合日志
-	combinedLogFile, err := os.OpenFile(filepath.Join("logs", "combined.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		log.Fatalf("无法创建综合日志文件：%v", err)
-	}
-	combinedLog = log.New(io.MultiWriter(os.Stdout, combinedLogFile), "", log.Ldate|log.Ltime|log.Lshortfile)
+// logger 第一次写日志时才创建日志目录与文件，导入本包不会在当前目录产生文件；
+// go test 中只输出到标准输出，不在各包的源码目录下生成 logs/
+func logger() *log.Logger {
+	combinedOnce.Do(func() {
+		var out io.Writer = os.Stdout
+		if !testing.Testing() {
+			// 初始化综合日志
+			if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
+				log.Fatalf("无法创建日志目录：%v", err)
+			}
+			combinedLogFile, err := os.OpenFile(filepath.Join(logDir, "combined.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+			if err != nil {
+				log.Fatalf("无法创建综合日志文件：%v", err)
+			}
+			out = io.MultiWriter(os.Stdout, combinedLogFile)
+		}
+		combinedLog = log.New(out, "", log.Ldate|log.Ltime|log.Lshortfile)
+	})
+	return combinedLog
 }
 
 func LogRuntime(message string) {
-	combinedLog.Printf("RUNTIME: %s", message)
+	logger().Printf("RUNTIME: %s", message)
 }
 
 func LogAPI(message string) {
-	combinedLog.Printf("API: %s", message)
+	logger().Printf("API: %s", message)
 }
 
 func LogUserMessage(userID int64, message string) {
-	combinedLog.Printf("USER %d: %s", userID, message)
+	logger().Printf("USER %d: %s", userID, message)
 }
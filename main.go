@@ -7,22 +7,35 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"tg-bot-go/config"
+	"tg-bot-go/dispatcher"
 	"tg-bot-go/handlers"
+	"tg-bot-go/llm"
 	"tg-bot-go/logger"
 	"tg-bot-go/models"
+	"tg-bot-go/tokenizer"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-var ctx = context.Background()
+const (
+	shutdownTimeout  = 30 * time.Second // 收到退出信号后等待处理中请求的最长时间
+	requestTimeout   = 10 * time.Minute // 单个更新的最长处理时间 (包括文档翻译)
+	maxConcurrent    = 10               // 最大并发处理数
+	maxQueuedPerUser = 3                // 每个用户最多排队等待的消息数
+)
 
 func main() {
 	// 添加开发模式标志
 	devMode := flag.Bool("dev", false, "Run in development mode")
+	// 接收更新的方式：polling (长轮询) 或 webhook
+	mode := flag.String("mode", "polling", "Update mode: polling or webhook")
 	flag.Parse()
 
 	// 根据运行模式加载环境变量
@@ -36,11 +49,25 @@ func main() {
 
 	// 初始化配置
 	config.InitConfig()
-	logger.LogRuntime(fmt.Sprintf("OpenAI config loaded: api_url=%s model=%s", config.Config.OpenAI.APIURL, config.Config.OpenAI.Model))
+
+	// 初始化大模型后端
+	providers, err := llm.NewRegistryFromConfig(config.Config)
+	if err != nil {
+		log.Fatalf("初始化大模型后端失败：%v", err)
+	}
+	logger.LogRuntime(fmt.Sprintf("LLM providers loaded: %v (default=%s)", providers.Names(), config.Config.LLM.Provider))
 
 	// 初始化数据库
 	config.InitDB()
 	models.MigrateWhitelist(config.DB)
+	models.MigrateUserSettings(config.DB)
+	models.MigrateUserPresets(config.DB)
+	models.MigrateGlobalPresets(config.DB)
+	models.MigrateGlossary(config.DB)
+	trigramSearch := models.MigrateTranslationMemory(config.DB)
+	if err := config.ReloadDBPresets(config.DB); err != nil {
+		log.Printf("Warning: Could not load presets from database: %v", err)
+	}
 
 	// 初始化管理员
 	config.InitAdminUser()
@@ -48,10 +75,13 @@ func main() {
 	// 初始化 Redis 客户端
 	rdb := handlers.InitRedis(config.Config.Redis.Addr)
 
-	// 清理 Redis 缓存
-	if err := rdb.FlushDB(ctx).Err(); err != nil {
-		log.Fatalf("无法清理 Redis 缓存：%v", err)
+	// 迁移并清理旧版本的 Redis 键 (不清空数据库，保留对话上下文与限流计数)
+	keys := handlers.NewKeys(config.Config.Redis.KeyPrefix)
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+	if err := handlers.MigrateKeys(migrateCtx, rdb, keys); err != nil {
+		log.Printf("Warning: Redis key migration failed: %v", err)
 	}
+	cancelMigrate()
 
 	// 获取 Telegram Bot Token
 	botToken := config.Config.Telegram.BotToken
@@ -68,55 +98,187 @@ func main() {
 	bot.Debug = true
 
 	// 初始化 Handler (依赖注入)
-	h := handlers.NewHandler(bot, config.DB, rdb)
+	h := handlers.NewHandler(bot, config.DB, rdb, providers)
+	h.Transcriber = llm.NewTranscriberFromConfig(config.Config)
+	h.Keys = keys
+	h.TrigramSearch = trigramSearch
+	h.Tokens = tokenizer.NewCounter(config.Config.Context.TokenizerDir, config.Config.Context.ModelWindows)
+	log.Printf("Context tokenizer: %s", h.Tokens)
 
-	// 删除 Webhook
-	_, err = bot.Request(tgbotapi.DeleteWebhookConfig{})
-	if err != nil {
-		log.Fatalf("删除 Webhook 失败：%v", err)
-	}
+	// 收到 SIGINT / SIGTERM 后停止接收更新，并等待处理中的请求完成
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// 设置长轮询
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	var updates tgbotapi.UpdatesChannel
+	var server *http.Server
+	switch *mode {
+	case "webhook":
+		updates, server, err = startWebhook(sigCtx, bot, config.Config.Telegram)
+		if err != nil {
+			log.Fatalf("启动 Webhook 失败：%v", err)
+		}
+	case "polling":
+		// 删除 Webhook
+		_, err = bot.Request(tgbotapi.DeleteWebhookConfig{})
+		if err != nil {
+			log.Fatalf("删除 Webhook 失败：%v", err)
+		}
 
-	updates := bot.GetUpdatesChan(u)
+		// 设置长轮询
+		u := tgbotapi.NewUpdate(0)
+		u.Timeout = 60
+
+		updates = bot.GetUpdatesChan(u)
+	default:
+		log.Fatalf("未知的运行模式：%s", *mode)
+	}
 
 	// 记录启动日志
 	logger.LogRuntime("Bot started successfully")
 
-	// 创建一个 WaitGroup 来管理 goroutines
-	var wg sync.WaitGroup
-	// 创建一个用户消息处理的通道，限制并发数
-	maxConcurrent := 10 // 最大并发处理数
-	sem := make(chan struct{}, maxConcurrent)
+	// 热加载 presets.toml 与数据库中的全局预设
+	go config.WatchPresets(sigCtx, config.PresetsFile, config.DB)
+	// 处理中请求的上下文，等待超时后取消，以中断仍在进行的大模型调用
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
 
-	// 处理消息
-	for update := range updates {
-		wg.Add(1)
-		sem <- struct{}{} // 获取信号量
-
-		go func(update tgbotapi.Update) {
-			defer wg.Done()
-			defer func() { <-sem }() // 释放信号量
+	// 同一聊天内同一用户的更新按顺序处理，不同用户之间并行
+	d := dispatcher.New(maxConcurrent, maxQueuedPerUser)
 
-			// 使用 recover 来防止 goroutine 崩溃
-			defer func() {
-				if r := recover(); r != nil {
-					logger.LogRuntime(fmt.Sprintf("Recovered from panic in message handler: %v", r))
-				}
-			}()
+	// 同一 key 的更新串行处理；内联查询先防抖
+	dispatch := func(update tgbotapi.Update) {
+		key := dispatchKey(update)
+		if h.IsCancelRequest(update) {
+			// 中止请求不能排在要中止的处理之后
+			key = fmt.Sprintf("cancel:%d", update.UpdateID)
+		}
+		job := func() {
+			// 每个更新使用带截止时间的上下文，贯穿 Redis、数据库与大模型调用
+			ctx, cancel := context.WithTimeout(runCtx, requestTimeout)
+			defer cancel()
 
 			if update.Message != nil {
-				h.HandleMessage(update)
+				h.HandleMessage(ctx, update)
 			} else if update.CallbackQuery != nil {
-				h.HandleCallback(update)
+				h.HandleCallback(ctx, update)
+			} else if update.InlineQuery != nil {
+				h.HandleInlineQuery(ctx, update)
+			}
+		}
+		if update.InlineQuery != nil {
+			// 每次按键都会产生新的查询，只处理用户停止输入后的最后一次，等待期间不占用并发名额
+			d.Debounce(key, handlers.INLINE_DEBOUNCE, job)
+			return
+		}
+		if !d.Submit(key, job) {
+			h.HandleBusy(update)
+		}
+	}
+
+	// 处理消息
+loop:
+	for {
+		select {
+		case <-sigCtx.Done():
+			break loop
+		case update, ok := <-updates:
+			if !ok {
+				break loop
+			}
+			dispatch(update)
+		}
+	}
+
+	logger.LogRuntime("Shutting down, waiting for in-flight requests...")
+	stop()
+
+	// 停止接收更新：Webhook 不再接受新请求，长轮询不再拉取
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Webhook server shutdown error: %v", err))
+		}
+		cancel()
+	} else {
+		bot.StopReceivingUpdates()
+	}
+
+	// 通道中的更新已向 Telegram 确认，不会再重发，全部交给调度器处理
+	drained := 0
+drain:
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				break drain
 			}
-		}(update)
+			dispatch(update)
+			drained++
+		default:
+			break drain
+		}
+	}
+	if drained > 0 {
+		logger.LogRuntime(fmt.Sprintf("Dispatched %d buffered updates before shutdown", drained))
+	}
+
+	// 等待所有排队与处理中的更新完成，超时后取消未完成的请求再稍等它们退出
+	// 后台的对话摘要同样需要等待，之后才能关闭 Redis
+	waitAll := func() {
+		d.Wait()
+		h.Wait()
+	}
+	if !waitTimeout(waitAll, shutdownTimeout) {
+		logger.LogRuntime(fmt.Sprintf("In-flight requests did not finish within %v, cancelling", shutdownTimeout))
+		cancelRun()
+		h.CancelBackground()
+		if !waitTimeout(waitAll, 5*time.Second) {
+			logger.LogRuntime("Some requests are still running, exiting anyway")
+		}
 	}
 
-	// 等待所有 goroutines 完成
-	wg.Wait()
+	// 关闭 Redis 与数据库连接
+	if err := rdb.Close(); err != nil {
+		logger.LogRuntime(fmt.Sprintf("Failed to close Redis: %v", err))
+	}
+	if sqlDB, err := config.DB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to close database: %v", err))
+		}
+	}
+	logger.LogRuntime("Bot stopped")
+}
+
+// dispatchKey 决定更新的串行顺序：消息与按钮回调按“聊天 + 用户”串行；
+// 内联查询按用户防抖并串行
+func dispatchKey(update tgbotapi.Update) string {
+	switch {
+	case update.Message != nil && update.Message.From != nil:
+		return fmt.Sprintf("%d:%d", update.Message.Chat.ID, update.Message.From.ID)
+	case update.Message != nil:
+		return fmt.Sprintf("%d", update.Message.Chat.ID)
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		return fmt.Sprintf("%d:%d", update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.From.ID)
+	case update.InlineQuery != nil:
+		return fmt.Sprintf("inline:%d", update.InlineQuery.From.ID)
+	default:
+		return fmt.Sprintf("update:%d", update.UpdateID)
+	}
+}
+
+// waitTimeout 等待 wait 返回，超时返回 false
+func waitTimeout(wait func(), timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 // 加载开发环境配置
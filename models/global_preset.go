@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GlobalPreset 管理员在数据库中维护的全局预设。
+// 与 presets.toml 中命令相同的记录覆盖文件中的对应字段，为 nil 的字段沿用文件中的值；
+// 文件中不存在的命令作为新增预设
+type GlobalPreset struct {
+	ID       uint    `gorm:"primaryKey"`
+	Command  string  `gorm:"size:64;uniqueIndex;not null"`
+	Button   *string `gorm:"size:64"`
+	Content  *string `gorm:"type:text"`
+	Provider *string `gorm:"size:64"`
+	Position *int    // 排序位置，为空时沿用文件中的顺序，新增预设排在最后
+	Disabled bool    `gorm:"default:false"`
+
+	// 生成参数，含义同 presets.toml
+	Model          *string `gorm:"size:128"`
+	Temperature    *float64
+	TopP           *float64
+	MaxTokens      *int
+	Stop           []string `gorm:"type:text;serializer:json"`
+	ResponseFormat *string  `gorm:"size:16"`
+	Pair           []string `gorm:"type:text;serializer:json"` // 自动互译的语言对
+
+	UpdatedAt time.Time
+}
+
+// 自动迁移
+func MigrateGlobalPresets(db *gorm.DB) {
+	db.AutoMigrate(&GlobalPreset{})
+}
+
+// 获取所有全局预设记录
+func ListGlobalPresets(db *gorm.DB) ([]GlobalPreset, error) {
+	var presets []GlobalPreset
+	err := db.Order("id").Find(&presets).Error
+	return presets, err
+}
+
+// 按命令更新全局预设的指定字段，记录不存在时创建
+func UpsertGlobalPreset(db *gorm.DB, command string, fields map[string]interface{}) error {
+	row := map[string]interface{}{"command": command, "updated_at": time.Now()}
+	columns := []string{"updated_at"}
+	for column, value := range fields {
+		row[column] = value
+		columns = append(columns, column)
+	}
+	return db.Model(&GlobalPreset{}).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "command"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(row).Error
+}
+
+// 删除全局预设记录，恢复为文件中的定义
+func DeleteGlobalPreset(db *gorm.DB, command string) error {
+	result := db.Where("command = ?", command).Delete(&GlobalPreset{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GlossaryEntry 术语表条目：将源语言中的术语固定译为目标语言中的指定译法。
+// 与设置相同按聊天保存，私聊中为用户本人的术语表，群聊中由整个群共享
+type GlossaryEntry struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ChatID      int64     `gorm:"uniqueIndex:idx_glossary_term;not null" json:"-"`
+	SourceLang  string    `gorm:"size:16;uniqueIndex:idx_glossary_term;not null" json:"source_lang"`
+	TargetLang  string    `gorm:"size:16;uniqueIndex:idx_glossary_term;not null" json:"target_lang"`
+	Term        string    `gorm:"size:128;uniqueIndex:idx_glossary_term;not null" json:"term"`
+	Translation string    `gorm:"size:256;not null" json:"translation"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// 自动迁移
+func MigrateGlossary(db *gorm.DB) {
+	db.AutoMigrate(&GlossaryEntry{})
+}
+
+// 获取聊天的全部术语，按语言对与术语排序
+func ListGlossary(db *gorm.DB, chatID int64) ([]GlossaryEntry, error) {
+	var entries []GlossaryEntry
+	err := db.Where("chat_id = ?", chatID).Order("source_lang, target_lang, term").Find(&entries).Error
+	return entries, err
+}
+
+// 统计聊天的术语数量
+func CountGlossary(db *gorm.DB, chatID int64) (int64, error) {
+	var count int64
+	err := db.Model(&GlossaryEntry{}).Where("chat_id = ?", chatID).Count(&count).Error
+	return count, err
+}
+
+// 批量保存术语，同一语言对中已存在的术语覆盖译法
+func SaveGlossaryEntries(db *gorm.DB, entries []GlossaryEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}, {Name: "source_lang"}, {Name: "target_lang"}, {Name: "term"}},
+		DoUpdates: clause.AssignmentColumns([]string{"translation"}),
+	}).Create(&entries).Error
+}
+
+// 删除聊天中的指定术语
+func DeleteGlossaryEntry(db *gorm.DB, chatID int64, id uint) error {
+	result := db.Where("id = ? AND chat_id = ?", id, chatID).Delete(&GlossaryEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// memoryFallbackCandidates 没有 pg_trgm 时在最近使用的多少条记录中计算相似度
+const memoryFallbackCandidates = 500
+
+// TranslationMemory 翻译记忆：某个预设下一段原文的译文。
+// Variant 为影响译文的提示词与设置的摘要，预设内容或设置变化后不再命中旧的译文
+type TranslationMemory struct {
+	ID         uint   `gorm:"primaryKey"`
+	Preset     string `gorm:"size:64;not null;uniqueIndex:idx_memory_source;index"`
+	Variant    string `gorm:"size:16;not null;uniqueIndex:idx_memory_source"`
+	SourceLang string `gorm:"size:16;not null;uniqueIndex:idx_memory_source"`
+	TargetLang string `gorm:"size:32;not null;uniqueIndex:idx_memory_source"`
+	SourceHash string `gorm:"size:64;not null;uniqueIndex:idx_memory_source"`
+	Source     string `gorm:"type:text;not null"`
+	Target     string `gorm:"type:text;not null"`
+	Hits       int    `gorm:"not null;default:0"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time // 最近一次写入或命中的时间
+
+	Score float64 `gorm:"->;-:migration"` // 模糊匹配时的相似度，不是数据库列
+}
+
+// MemoryScope 翻译记忆的查找范围
+type MemoryScope struct {
+	Preset     string
+	Variant    string
+	SourceLang string
+	TargetLang string
+}
+
+// 自动迁移，并尝试启用 pg_trgm 与三字母组索引；返回是否可以在数据库中做模糊匹配
+func MigrateTranslationMemory(db *gorm.DB) bool {
+	db.AutoMigrate(&TranslationMemory{})
+
+	// 创建扩展需要相应的数据库权限，失败时退回到在程序中计算相似度
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("Warning: pg_trgm is not available, translation memory falls back to in-process fuzzy matching: %v", err)
+		return false
+	}
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_memory_source_trgm ON translation_memories USING gin (source gin_trgm_ops)").Error; err != nil {
+		log.Printf("Warning: Could not create trigram index for translation memory: %v", err)
+	}
+	return true
+}
+
+// 原文的摘要，用于精确匹配
+func memorySourceHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// 精确查找原文的译文，命中时累加命中次数；没有记录时返回 nil
+func FindExactMemory(db *gorm.DB, scope MemoryScope, source string) (*TranslationMemory, error) {
+	var memory TranslationMemory
+	// 语言可能为空，不能用结构体作为条件 (零值字段会被忽略)
+	err := db.Where("preset = ? AND variant = ? AND source_lang = ? AND target_lang = ? AND source_hash = ?",
+		scope.Preset, scope.Variant, scope.SourceLang, scope.TargetLang, memorySourceHash(source)).
+		Limit(1).Find(&memory).Error
+	if err != nil || memory.ID == 0 {
+		return nil, err
+	}
+	db.Model(&memory).UpdateColumns(map[string]interface{}{"hits": gorm.Expr("hits + 1"), "updated_at": time.Now()})
+	return &memory, nil
+}
+
+// 查找同一预设与语言对中相似的原文，按相似度从高到低返回最多 limit 条，不包括完全相同的原文
+func FindSimilarMemories(db *gorm.DB, scope MemoryScope, source string, threshold float64, limit int, trgm bool) ([]TranslationMemory, error) {
+	query := db.Where("preset = ? AND source_lang = ? AND target_lang = ? AND source_hash <> ?",
+		scope.Preset, scope.SourceLang, scope.TargetLang, memorySourceHash(source))
+
+	var memories []TranslationMemory
+	if trgm {
+		// % 运算符可以使用三字母组索引，similarity 再按阈值精确过滤
+		err := query.Select("*, similarity(source, ?) AS score", source).
+			Where("source % ? AND similarity(source, ?) >= ?", source, source, threshold).
+			Order("score DESC").Limit(limit).Find(&memories).Error
+		return memories, err
+	}
+
+	if err := query.Order("updated_at DESC").Limit(memoryFallbackCandidates).Find(&memories).Error; err != nil {
+		return nil, err
+	}
+	var similar []TranslationMemory
+	for _, m := range memories {
+		if m.Score = TrigramSimilarity(source, m.Source); m.Score >= threshold {
+			similar = append(similar, m)
+		}
+	}
+	sort.SliceStable(similar, func(a, b int) bool { return similar[a].Score > similar[b].Score })
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+	return similar, nil
+}
+
+// 保存译文，同一原文已存在时覆盖
+func SaveMemory(db *gorm.DB, scope MemoryScope, source, target string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "preset"}, {Name: "variant"}, {Name: "source_lang"}, {Name: "target_lang"}, {Name: "source_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"target", "updated_at"}),
+	}).Create(&TranslationMemory{
+		Preset: scope.Preset, Variant: scope.Variant, SourceLang: scope.SourceLang, TargetLang: scope.TargetLang,
+		SourceHash: memorySourceHash(source), Source: source, Target: target,
+	}).Error
+}
+
+// 按原文或译文中的关键词查找记录，关键词为空时返回最近使用的记录
+func SearchMemories(db *gorm.DB, keyword string, limit int) ([]TranslationMemory, error) {
+	query := db.Order("updated_at DESC").Limit(limit)
+	if keyword != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(keyword) + "%"
+		query = query.Where("source ILIKE ? OR target ILIKE ?", pattern, pattern)
+	}
+	var memories []TranslationMemory
+	err := query.Find(&memories).Error
+	return memories, err
+}
+
+// 获取指定记录
+func GetMemory(db *gorm.DB, id uint) (*TranslationMemory, error) {
+	var memory TranslationMemory
+	if err := db.First(&memory, id).Error; err != nil {
+		return nil, err
+	}
+	return &memory, nil
+}
+
+// MemoryStat 每个预设的记录数与命中次数
+type MemoryStat struct {
+	Preset string
+	Count  int64
+	Hits   int64
+}
+
+// 按预设统计翻译记忆
+func MemoryStats(db *gorm.DB) ([]MemoryStat, error) {
+	var stats []MemoryStat
+	err := db.Model(&TranslationMemory{}).
+		Select("preset, COUNT(*) AS count, COALESCE(SUM(hits), 0) AS hits").
+		Group("preset").Order("count DESC").Scan(&stats).Error
+	return stats, err
+}
+
+// 删除指定记录
+func DeleteMemory(db *gorm.DB, id uint) error {
+	result := db.Delete(&TranslationMemory{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// 批量删除记录：preset 不为空时只删除该预设的记录，before 不为零时只删除此前未使用过的记录
+func PurgeMemories(db *gorm.DB, preset string, before time.Time) (int64, error) {
+	query := db.Where("1 = 1")
+	if preset != "" {
+		query = query.Where("preset = ?", preset)
+	}
+	if !before.IsZero() {
+		query = query.Where("updated_at < ?", before)
+	}
+	result := query.Delete(&TranslationMemory{})
+	return result.RowsAffected, result.Error
+}
+
+// TrigramSimilarity 与 pg_trgm 的 similarity 相同的算法：按单词取三字母组 (词首补两个空格、词尾补一个空格)，
+// 返回两组三字母组的交集与并集之比
+func TrigramSimilarity(a, b string) float64 {
+	ta, tb := trigramSet(a), trigramSet(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func trigramSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// String 管理员查看时的简要说明
+func (m TranslationMemory) String() string {
+	return fmt.Sprintf("#%d %s %s→%s 命中 %d 次", m.ID, m.Preset, m.SourceLang, m.TargetLang, m.Hits)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrigramSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		// 与 PostgreSQL 文档中 similarity('word', 'two words') 的结果一致
+		{"pg_trgm example", "word", "two words", 4.0 / 11},
+		{"identical", "hello world", "hello world", 1},
+		{"case and punctuation ignored", "Hello, World!", "world hello", 1},
+		{"partial overlap", "cat", "cart", 2.0 / 7},
+		{"no overlap", "abc", "xyz", 0},
+		{"cjk", "你好世界", "你好世界", 1},
+		{"empty", "", "word", 0},
+		{"only punctuation", "...", "!!!", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TrigramSimilarity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("TrigramSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if reverse := TrigramSimilarity(tt.b, tt.a); math.Abs(reverse-got) > 1e-9 {
+				t.Fatalf("similarity should be symmetric: %v vs %v", got, reverse)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 用户预设的状态
+const (
+	PresetStatusPrivate  = "private"  // 仅创建者可用
+	PresetStatusPending  = "pending"  // 已申请分享，等待管理员审核
+	PresetStatusApproved = "approved" // 审核通过，其他用户可通过分享码导入
+	PresetStatusRejected = "rejected" // 分享申请被拒绝，创建者仍可自用
+	PresetStatusDisabled = "disabled" // 被管理员禁用，创建者也无法使用
+)
+
+// UserPreset 用户自定义的 System Prompt
+type UserPreset struct {
+	ID        uint   `gorm:"primaryKey"`
+	OwnerID   int64  `gorm:"index;not null"`
+	Name      string `gorm:"size:64;not null"`
+	Content   string `gorm:"type:text;not null"`
+	Status    string `gorm:"size:16;index;not null;default:private"`
+	ShareCode string `gorm:"size:16;uniqueIndex;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Usable 判断预设是否可以被选用
+func (p *UserPreset) Usable() bool {
+	return p.Status != PresetStatusDisabled
+}
+
+// 自动迁移
+func MigrateUserPresets(db *gorm.DB) {
+	db.AutoMigrate(&UserPreset{})
+}
+
+// 创建用户预设，分享码在创建时生成
+func CreateUserPreset(db *gorm.DB, preset *UserPreset) error {
+	code, err := newShareCode()
+	if err != nil {
+		return err
+	}
+	preset.ShareCode = code
+	if preset.Status == "" {
+		preset.Status = PresetStatusPrivate
+	}
+	return db.Create(preset).Error
+}
+
+// 保存对用户预设的修改
+func UpdateUserPreset(db *gorm.DB, preset *UserPreset) error {
+	return db.Save(preset).Error
+}
+
+// 获取指定预设
+func GetUserPreset(db *gorm.DB, id uint) (*UserPreset, error) {
+	var preset UserPreset
+	if err := db.First(&preset, id).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// 获取用户的所有预设
+func ListUserPresets(db *gorm.DB, ownerID int64) ([]UserPreset, error) {
+	var presets []UserPreset
+	err := db.Where("owner_id = ?", ownerID).Order("id").Find(&presets).Error
+	return presets, err
+}
+
+// 统计用户的预设数量
+func CountUserPresets(db *gorm.DB, ownerID int64) (int64, error) {
+	var count int64
+	err := db.Model(&UserPreset{}).Where("owner_id = ?", ownerID).Count(&count).Error
+	return count, err
+}
+
+// 删除用户自己的预设
+func DeleteUserPreset(db *gorm.DB, ownerID int64, id uint) error {
+	result := db.Where("id = ? AND owner_id = ?", id, ownerID).Delete(&UserPreset{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// 按分享码查找审核通过的预设
+func FindSharedPreset(db *gorm.DB, code string) (*UserPreset, error) {
+	var preset UserPreset
+	if err := db.Where("share_code = ? AND status = ?", code, PresetStatusApproved).First(&preset).Error; err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// 获取等待审核的预设
+func ListPendingPresets(db *gorm.DB) ([]UserPreset, error) {
+	var presets []UserPreset
+	err := db.Where("status = ?", PresetStatusPending).Order("updated_at").Find(&presets).Error
+	return presets, err
+}
+
+// 更新预设状态
+func SetUserPresetStatus(db *gorm.DB, id uint, status string) error {
+	result := db.Model(&UserPreset{}).Where("id = ?", id).Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func newShareCode() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
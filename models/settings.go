@@ -0,0 +1,50 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UserSettings 聊天的个人设置，私聊中即用户本人的设置，群聊中由整个群共享
+type UserSettings struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	ChatID         int64     `gorm:"uniqueIndex" json:"chat_id"`
+	Preset         string    `json:"preset"`          // 选择的预设命令，为空时使用默认对话
+	TargetLanguage string    `json:"target_language"` // 目标语言，为空时由预设决定
+	Targets        string    `json:"targets"`         // 多语言同时翻译的目标语言，逗号分隔，为空时不开启
+	Model          string    `json:"model"`           // 后端与模型，格式为 provider[:model]，为空时由预设决定
+	Formality      string    `json:"formality"`       // 语气：formal / informal，为空时不限制
+	UILanguage     string    `json:"ui_language"`     // 界面语言：zh / en
+	UpdatedAt      time.Time `json:"-"`
+}
+
+// 自动迁移
+func MigrateUserSettings(db *gorm.DB) {
+	db.AutoMigrate(&UserSettings{})
+}
+
+// 获取聊天设置，尚未保存过时返回空设置
+func GetUserSettings(db *gorm.DB, chatID int64) (*UserSettings, error) {
+	var settings UserSettings
+	if err := db.Where("chat_id = ?", chatID).First(&settings).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &UserSettings{ChatID: chatID}, nil
+		}
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// 保存聊天设置，已存在时覆盖
+func SaveUserSettings(db *gorm.DB, settings *UserSettings) error {
+	// 按 chat_id 冲突更新，主键交给数据库生成
+	row := *settings
+	row.ID = 0
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chat_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"preset", "target_language", "targets", "model", "formality", "ui_language", "updated_at"}),
+	}).Create(&row).Error
+}
@@ -0,0 +1,405 @@
+// Package render 将大模型输出的 Markdown 转换为 Telegram 支持的 HTML，并按消息长度上限切分
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk 一条消息的内容：HTML 以 parse_mode=HTML 发送，Telegram 无法解析时改为发送原始文本 Text
+type Chunk struct {
+	HTML string
+	Text string
+}
+
+// block 段落或代码块，是切分消息时的最小单位 (过长时才在行内切开)
+type block struct {
+	source string // 原始 Markdown
+	html   string
+	code   bool
+	lang   string
+	lines  []string // 段落的原始行，或代码块的内容行
+}
+
+// HTML 将整段 Markdown 转换为 Telegram HTML，不做切分
+func HTML(markdown string) string {
+	var parts []string
+	for _, b := range parseBlocks(markdown) {
+		parts = append(parts, b.html)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Split 转换 Markdown 并切分为多条消息，每条的 HTML 与原始文本都不超过 limit (按 Telegram 的 UTF-16 长度计算)。
+// 尽量在段落与代码块之间切分，单个段落或代码块过长时按行切分，代码块切开后各部分仍是完整的代码块
+func Split(markdown string, limit int) []Chunk {
+	var chunks []Chunk
+	var cur Chunk
+	for _, b := range parseBlocks(markdown) {
+		for _, piece := range fit(b, limit) {
+			if cur.HTML != "" && max(length(cur.HTML), length(cur.Text))+2+size(piece) > limit {
+				chunks = append(chunks, cur)
+				cur = Chunk{}
+			}
+			if cur.HTML != "" {
+				cur.HTML += "\n\n"
+				cur.Text += "\n\n"
+			}
+			cur.HTML += piece.html
+			cur.Text += piece.source
+		}
+	}
+	if cur.HTML != "" {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// fit 将超出 limit 的段落或代码块按行 (单行过长时按字符) 切分为多个块
+func fit(b block, limit int) []block {
+	if size(b) <= limit {
+		return []block{b}
+	}
+	build := func(lines []string) block {
+		if b.code {
+			return codeBlock(b.lang, lines)
+		}
+		return paragraph(lines)
+	}
+
+	var pieces []block
+	var lines []string
+	for _, line := range b.lines {
+		if next := build(append(lines, line)); len(lines) > 0 && size(next) > limit {
+			pieces = append(pieces, build(lines))
+			lines = nil
+		}
+		if size(build([]string{line})) <= limit {
+			lines = append(lines, line)
+			continue
+		}
+		// 单行过长：按字符切开，转义后可能变长，不满足时减半重试
+		runes := []rune(line)
+		for len(runes) > 0 {
+			n := min(len(runes), limit/2)
+			for n > 1 && size(build([]string{string(runes[:n])})) > limit {
+				n /= 2
+			}
+			pieces = append(pieces, build([]string{string(runes[:n])}))
+			runes = runes[n:]
+		}
+	}
+	if len(lines) > 0 {
+		pieces = append(pieces, build(lines))
+	}
+	return pieces
+}
+
+// size 块发送时占用的长度，纯文本回退时同样不能超出上限
+func size(b block) int {
+	return max(length(b.html), length(b.source))
+}
+
+// length 按 UTF-16 编码单元计算长度，与 Telegram 的消息长度限制一致
+func length(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// parseBlocks 按空行与代码围栏将 Markdown 分为段落与代码块
+func parseBlocks(markdown string) []block {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var blocks []block
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			blocks = append(blocks, paragraph(para))
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); i++ {
+		fence, lang, ok := openFence(lines[i])
+		if !ok {
+			if strings.TrimSpace(lines[i]) == "" {
+				flush()
+			} else {
+				para = append(para, lines[i])
+			}
+			continue
+		}
+		// 代码块：未闭合时一直到文本末尾
+		flush()
+		var code []string
+		for i++; i < len(lines) && !closesFence(lines[i], fence); i++ {
+			code = append(code, lines[i])
+		}
+		blocks = append(blocks, codeBlock(lang, code))
+	}
+	flush()
+	return blocks
+}
+
+// openFence 判断是否为代码块的起始行 (``` 或 ~~~)，返回围栏与语言
+func openFence(line string) (fence, lang string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(trimmed[n:])
+	if trimmed[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		lang = fields[0]
+	}
+	return trimmed[:n], lang, true
+}
+
+// closesFence 判断是否为与 fence 对应的结束行
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// codeBlock 生成代码块，语言名只保留安全字符
+func codeBlock(lang string, lines []string) block {
+	lang = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (isWordByte(byte(r)) || strings.ContainsRune("+#.-", r)) {
+			return r
+		}
+		return -1
+	}, lang)
+	code := escape(strings.Join(lines, "\n"))
+	html := "<pre>" + code + "</pre>"
+	if lang != "" {
+		html = `<pre><code class="language-` + lang + `">` + code + "</code></pre>"
+	}
+	return block{
+		source: "```" + lang + "\n" + strings.Join(lines, "\n") + "\n```",
+		html:   html,
+		code:   true,
+		lang:   lang,
+		lines:  lines,
+	}
+}
+
+// paragraph 渲染一个段落，连续的引用行合并为一个引用块
+func paragraph(lines []string) block {
+	var out, quote []string
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			quote = nil
+		}
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, ">") {
+			quote = append(quote, renderLine(strings.TrimPrefix(trimmed[1:], " ")))
+			continue
+		}
+		flushQuote()
+		out = append(out, renderLine(line))
+	}
+	flushQuote()
+	return block{source: strings.Join(lines, "\n"), html: strings.Join(out, "\n"), lines: lines}
+}
+
+// renderLine 渲染标题、列表、分隔线等行级格式，Telegram 不支持的格式转换为近似的纯文本
+func renderLine(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(trimmed)]
+
+	// 标题显示为粗体
+	if level := strings.IndexFunc(trimmed, func(r rune) bool { return r != '#' }); level >= 1 && level <= 6 && trimmed[level] == ' ' {
+		title := strings.TrimRight(strings.TrimSpace(trimmed[level:]), "#")
+		return "<b>" + inline(strings.TrimSpace(title)) + "</b>"
+	}
+	// 分隔线
+	if isRule(trimmed) {
+		return "——————"
+	}
+	// 无序列表
+	if len(trimmed) > 2 && strings.ContainsRune("-*+", rune(trimmed[0])) && trimmed[1] == ' ' {
+		return indent + "• " + inline(strings.TrimLeft(trimmed[2:], " "))
+	}
+	return inline(line)
+}
+
+// isRule 判断是否为 ---、*** 或 ___ 形式的分隔线
+func isRule(line string) bool {
+	line = strings.ReplaceAll(strings.TrimSpace(line), " ", "")
+	return len(line) >= 3 && strings.Trim(line, line[:1]) == "" && strings.ContainsRune("-*_", rune(line[0]))
+}
+
+// inline 渲染行内格式：代码、链接、粗体、斜体与删除线，其余字符转义
+func inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '`':
+			delim := s[i : i+runLength(s[i:], '`')]
+			if end := strings.Index(s[i+len(delim):], delim); end > 0 {
+				b.WriteString("<code>" + escape(s[i+len(delim):i+len(delim)+end]) + "</code>")
+				i += 2*len(delim) + end
+				continue
+			}
+			b.WriteString(delim)
+			i += len(delim)
+			continue
+		case c == '[':
+			if text, url, n, ok := parseLink(s[i:]); ok {
+				b.WriteString(`<a href="` + escape(url) + `">` + inline(text) + "</a>")
+				i += n
+				continue
+			}
+		case c == '*' || c == '_' || c == '~':
+			if html, n, ok := emphasis(s, i); ok {
+				b.WriteString(html)
+				i += n
+				continue
+			}
+		}
+		b.WriteString(escape(s[i : i+1]))
+		i++
+	}
+	return b.String()
+}
+
+var emphasisTags = []struct{ delim, open, close string }{
+	{"***", "<b><i>", "</i></b>"},
+	{"**", "<b>", "</b>"},
+	{"__", "<b>", "</b>"},
+	{"~~", "<s>", "</s>"},
+	{"*", "<i>", "</i>"},
+	{"_", "<i>", "</i>"},
+}
+
+// emphasis 解析 s[i:] 开头的强调，返回渲染结果与消耗的字节数
+func emphasis(s string, i int) (string, int, bool) {
+	for _, e := range emphasisTags {
+		if !strings.HasPrefix(s[i:], e.delim) {
+			continue
+		}
+		start := i + len(e.delim)
+		// 起始符后不能是空白；下划线不在单词内部生效，避免误伤 snake_case
+		if start >= len(s) || s[start] == ' ' || (e.delim[0] == '_' && i > 0 && isWordByte(s[i-1])) {
+			return "", 0, false
+		}
+		if len(e.delim) == 1 && s[start] == e.delim[0] {
+			return "", 0, false
+		}
+		end := findCloser(s, start, e.delim)
+		if end < 0 {
+			continue
+		}
+		return e.open + inline(s[start:end]) + e.close, end + len(e.delim) - i, true
+	}
+	return "", 0, false
+}
+
+// findCloser 查找与 delim 对应的结束符，跳过行内代码
+func findCloser(s string, start int, delim string) int {
+	for j := start + 1; j < len(s); j++ {
+		if s[j] == '`' {
+			n := runLength(s[j:], '`')
+			if end := strings.Index(s[j+n:], s[j:j+n]); end >= 0 {
+				j += 2*n + end - 1
+			}
+			continue
+		}
+		if !strings.HasPrefix(s[j:], delim) || s[j-1] == ' ' {
+			continue
+		}
+		after := j + len(delim)
+		if len(delim) == 1 && (s[j-1] == delim[0] || (after < len(s) && s[after] == delim[0])) {
+			continue
+		}
+		if delim[0] == '_' && after < len(s) && isWordByte(s[after]) {
+			continue
+		}
+		return j
+	}
+	return -1
+}
+
+// parseLink 解析 [文字](链接)，只接受 http、https、tg 与 mailto 链接
+func parseLink(s string) (text, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			fields := strings.Fields(s[i+2 : i+2+end])
+			if len(fields) == 0 || !allowedURL(fields[0]) || i == 1 {
+				return "", "", 0, false
+			}
+			return s[1:i], fields[0], i + 3 + end, true
+		}
+	}
+	return "", "", 0, false
+}
+
+func allowedURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range []string{"http://", "https://", "tg://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// escape 转义 Telegram HTML 中的特殊字符
+func escape(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func runLength(s string, c byte) int {
+	n := 0
+	for n < len(s) && s[n] == c {
+		n++
+	}
+	return n
+}
+
+// isWordByte 字母、数字、下划线以及非 ASCII 字符 (如中文) 视为单词的一部分
+func isWordByte(c byte) bool {
+	return c == '_' || c >= utf8.RuneSelf || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
@@ -0,0 +1,171 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		// 转义
+		{"escape", `a < b && c > "d"`, "a &lt; b &amp;&amp; c &gt; &quot;d&quot;"},
+		{"html tags are text", "<b>not bold</b>", "&lt;b&gt;not bold&lt;/b&gt;"},
+		{"escape in code", "`a<b>&`", "<code>a&lt;b&gt;&amp;</code>"},
+		{"backslash escape", `\*not italic\*`, "*not italic*"},
+
+		// 强调
+		{"bold", "**bold**", "<b>bold</b>"},
+		{"underscore bold", "__bold__", "<b>bold</b>"},
+		{"italic", "*it* and _it_", "<i>it</i> and <i>it</i>"},
+		{"bold italic", "***both***", "<b><i>both</i></b>"},
+		{"strike", "~~gone~~", "<s>gone</s>"},
+		{"nested", "**bold _and italic_**", "<b>bold <i>and italic</i></b>"},
+		{"link with emphasis", "[**docs**](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2"><b>docs</b></a>`},
+		{"code inside bold", "**use `a*b`**", "<b>use <code>a*b</code></b>"},
+
+		// 不成对的标记原样输出
+		{"unbalanced star", "2 * 3 = 6", "2 * 3 = 6"},
+		{"unclosed bold", "**not closed", "**not closed"},
+		{"unclosed italic", "*a", "*a"},
+		{"snake case", "call snake_case_name now", "call snake_case_name now"},
+		{"unclosed code", "`open", "`open"},
+		{"space before closer", "*a *", "*a *"},
+
+		// 链接
+		{"unsafe link", "[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"empty link text", "[](https://example.com)", "[](https://example.com)"},
+
+		// 行级格式
+		{"heading", "## Title ##", "<b>Title</b>"},
+		{"list", "- one\n  * two", "• one\n  • two"},
+		{"rule", "---", "——————"},
+		{"quote", "> a\n> **b**\nc", "<blockquote>a\n<b>b</b></blockquote>\nc"},
+
+		// 代码块
+		{"code block", "```go\nif a < b {}\n```", `<pre><code class="language-go">if a &lt; b {}</code></pre>`},
+		{"code block without language", "~~~\n**raw**\n~~~", "<pre>**raw**</pre>"},
+		{"unsafe language", "```a\"><b>\nx\n```", `<pre><code class="language-ab">x</code></pre>`},
+		{"unclosed code block", "```\nx\n\ny", "<pre>x\n\ny</pre>"},
+		{"paragraphs", "a\n\n\nb", "a\n\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.md); got != tt.want {
+				t.Fatalf("HTML(%q)\n got: %q\nwant: %q", tt.md, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	paragraphs := strings.Repeat("第一段文字。\n\n", 30)
+	longLine := strings.Repeat("**粗体** <与> 普通文字 ", 50)
+	code := "```python\n" + strings.Repeat("print('<tag>')\n", 80) + "```"
+	emoji := strings.Repeat("😀", 120)
+
+	tests := []struct {
+		name  string
+		md    string
+		limit int
+	}{
+		{"paragraphs", paragraphs, 100},
+		{"long line", longLine, 200},
+		{"code block", code, 300},
+		{"code block after text", "介绍：\n\n" + code + "\n\n结尾", 300},
+		{"surrogate pairs", emoji, 50},
+		{"telegram limit", strings.Repeat("**word** & <tag> ", 2000), 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(tt.md, tt.limit)
+			if len(chunks) < 2 {
+				t.Fatalf("expected the input to be split, got %d chunk(s)", len(chunks))
+			}
+			for i, c := range chunks {
+				if n := length(c.HTML); n > tt.limit {
+					t.Fatalf("chunk %d HTML is %d UTF-16 units, limit %d", i, n, tt.limit)
+				}
+				if n := length(c.Text); n > tt.limit {
+					t.Fatalf("chunk %d text is %d UTF-16 units, limit %d", i, n, tt.limit)
+				}
+				if err := checkTags(c.HTML); err != "" {
+					t.Fatalf("chunk %d has unbalanced tags (%s): %q", i, err, c.HTML)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitKeepsCodeFences(t *testing.T) {
+	code := "```go\n" + strings.Repeat("x := 1\n", 100) + "```"
+	chunks := Split(code, 200)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	lines := 0
+	for i, c := range chunks {
+		if !strings.HasPrefix(c.HTML, `<pre><code class="language-go">`) || !strings.HasSuffix(c.HTML, "</code></pre>") {
+			t.Fatalf("chunk %d is not a complete code block: %q", i, c.HTML)
+		}
+		if !strings.HasPrefix(c.Text, "```go\n") || !strings.HasSuffix(c.Text, "\n```") {
+			t.Fatalf("chunk %d fallback text is not fenced: %q", i, c.Text)
+		}
+		lines += strings.Count(c.HTML, "x := 1")
+	}
+	if lines != 100 {
+		t.Fatalf("expected all 100 lines across chunks, got %d", lines)
+	}
+}
+
+func TestSplitShortMessage(t *testing.T) {
+	chunks := Split("**hi** there", 4096)
+	if len(chunks) != 1 || chunks[0].HTML != "<b>hi</b> there" || chunks[0].Text != "**hi** there" {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+	if chunks := Split("", 4096); len(chunks) != 0 {
+		t.Fatalf("empty input should produce no chunks, got %+v", chunks)
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"abc", 3},
+		{"中文", 2},
+		{"😀", 2},
+		{"a😀b", 4},
+	}
+	for _, tt := range tests {
+		if got := length(tt.s); got != tt.want {
+			t.Errorf("length(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+var tagRe = regexp.MustCompile(`<(/?)([a-z]+)[^>]*>`)
+
+// checkTags 检查 HTML 标签是否成对且正确嵌套，返回问题说明，没有问题时为空
+func checkTags(html string) string {
+	var stack []string
+	for _, m := range tagRe.FindAllStringSubmatch(html, -1) {
+		if m[1] == "" {
+			stack = append(stack, m[2])
+			continue
+		}
+		if len(stack) == 0 || stack[len(stack)-1] != m[2] {
+			return "unexpected </" + m[2] + ">"
+		}
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) > 0 {
+		return "unclosed <" + stack[len(stack)-1] + ">"
+	}
+	return ""
+}
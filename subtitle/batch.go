@@ -0,0 +1,57 @@
+package subtitle
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var markerRe = regexp.MustCompile(`^#(\d+)$`)
+
+// Instruction 追加到翻译预设之后的批量字幕格式说明
+const Instruction = "\n\n输入是若干条字幕，每条以单独一行的 #序号 开头，后面是字幕文本。" +
+	"请逐条翻译字幕文本，保留每条的 #序号 行及其顺序，不要合并、拆分或省略任何一条，不要添加任何解释。"
+
+// EncodeBatch 将一批字幕编码为带序号的文本
+func EncodeBatch(cues []*Cue) string {
+	var out strings.Builder
+	for i, cue := range cues {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "#%d\n%s", i+1, strings.Join(cue.Lines, "\n"))
+	}
+	return out.String()
+}
+
+// DecodeBatch 解析模型返回的带序号译文，条数或序号与输入不一致时返回错误
+func DecodeBatch(text string, count int) ([][]string, error) {
+	texts := make([][]string, count)
+	seen := make([]bool, count)
+	current := -1
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := markerRe.FindStringSubmatch(trimmed); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			if n < 1 || n > count || seen[n-1] {
+				return nil, fmt.Errorf("unexpected cue marker #%d", n)
+			}
+			current = n - 1
+			seen[current] = true
+			continue
+		}
+		if current < 0 || trimmed == "" {
+			continue
+		}
+		texts[current] = append(texts[current], trimmed)
+	}
+
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("missing cue #%d", i+1)
+		}
+	}
+	return texts, nil
+}
@@ -0,0 +1,149 @@
+package subtitle
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format 字幕格式
+type Format string
+
+const (
+	FormatSRT Format = "srt"
+	FormatVTT Format = "vtt"
+)
+
+// Cue 一条字幕，只有 Lines 会被翻译，序号与时间轴原样保留
+type Cue struct {
+	ID     string // SRT 序号或 VTT 标识，可为空 (VTT)
+	Timing string // 时间轴行，例如 00:00:01,000 --> 00:00:02,500
+	Lines  []string
+}
+
+// block 文件中的一个块：字幕或需要原样保留的内容 (WEBVTT 头、NOTE、STYLE 等)
+type block struct {
+	raw string
+	cue *Cue
+}
+
+// File 解析后的字幕文件
+type File struct {
+	Format Format
+	blocks []block
+}
+
+// Parse 解析 SRT 或 VTT 字幕
+func Parse(format Format, data string) (*File, error) {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+
+	f := &File{Format: format}
+	for i, raw := range splitBlocks(data) {
+		lines := strings.Split(raw, "\n")
+
+		if format == FormatVTT && i == 0 {
+			if !strings.HasPrefix(lines[0], "WEBVTT") {
+				return nil, fmt.Errorf("vtt: missing WEBVTT header")
+			}
+			f.blocks = append(f.blocks, block{raw: raw})
+			continue
+		}
+
+		timingLine := -1
+		for j, line := range lines {
+			if strings.Contains(line, "-->") {
+				timingLine = j
+				break
+			}
+		}
+
+		switch {
+		case timingLine == -1:
+			if format == FormatSRT {
+				return nil, fmt.Errorf("srt: block %d has no timing line", i+1)
+			}
+			// VTT 的 NOTE / STYLE / REGION 块原样保留
+			f.blocks = append(f.blocks, block{raw: raw})
+		case timingLine > 1:
+			return nil, fmt.Errorf("%s: malformed cue in block %d", format, i+1)
+		default:
+			cue := &Cue{Timing: lines[timingLine], Lines: lines[timingLine+1:]}
+			if timingLine == 1 {
+				cue.ID = lines[0]
+			}
+			f.blocks = append(f.blocks, block{cue: cue})
+		}
+	}
+	if len(f.Cues()) == 0 {
+		return nil, fmt.Errorf("%s: no cues found", format)
+	}
+	return f, nil
+}
+
+// Cues 按顺序返回所有字幕
+func (f *File) Cues() []*Cue {
+	var cues []*Cue
+	for _, b := range f.blocks {
+		if b.cue != nil {
+			cues = append(cues, b.cue)
+		}
+	}
+	return cues
+}
+
+// SetText 用译文替换字幕文本，texts 必须与 Cues 一一对应
+func (f *File) SetText(texts [][]string) error {
+	cues := f.Cues()
+	if len(texts) != len(cues) {
+		return fmt.Errorf("cue count mismatch: expected %d, got %d", len(cues), len(texts))
+	}
+	for i, cue := range cues {
+		cue.Lines = texts[i]
+	}
+	return nil
+}
+
+// String 重新生成字幕文件内容
+func (f *File) String() string {
+	var out strings.Builder
+	for i, b := range f.blocks {
+		if i > 0 {
+			out.WriteString("\n\n")
+		}
+		if b.cue == nil {
+			out.WriteString(b.raw)
+			continue
+		}
+		if b.cue.ID != "" {
+			out.WriteString(b.cue.ID)
+			out.WriteString("\n")
+		}
+		out.WriteString(b.cue.Timing)
+		for _, line := range b.cue.Lines {
+			out.WriteString("\n")
+			out.WriteString(line)
+		}
+	}
+	out.WriteString("\n")
+	return out.String()
+}
+
+// splitBlocks 按空行拆分块
+func splitBlocks(data string) []string {
+	var blocks []string
+	var current []string
+	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, strings.TrimRight(line, " \t"))
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
@@ -0,0 +1,125 @@
+package subtitle
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   string
+		cues   int
+	}{
+		{
+			name:   "srt",
+			format: FormatSRT,
+			data:   "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			want:   "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nTwo\nlines\n",
+			cues:   2,
+		},
+		{
+			name:   "srt with bom, crlf and extra blank lines",
+			format: FormatSRT,
+			data:   "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nHi  \r\n\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nBye\r\n",
+			want:   "1\n00:00:01,000 --> 00:00:02,000\nHi\n\n2\n00:00:03,000 --> 00:00:04,000\nBye\n",
+			cues:   2,
+		},
+		{
+			name:   "vtt keeps header, notes and styles",
+			format: FormatVTT,
+			data:   "WEBVTT - title\n\nNOTE a comment\n\nSTYLE\n::cue { color: red }\n\n00:01.000 --> 00:02.000 align:start\nNo id\n\nintro\n00:03.000 --> 00:04.000\nWith id\n",
+			want:   "WEBVTT - title\n\nNOTE a comment\n\nSTYLE\n::cue { color: red }\n\n00:01.000 --> 00:02.000 align:start\nNo id\n\nintro\n00:03.000 --> 00:04.000\nWith id\n",
+			cues:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(tt.format, tt.data)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if n := len(f.Cues()); n != tt.cues {
+				t.Fatalf("expected %d cues, got %d", tt.cues, n)
+			}
+			if got := f.String(); got != tt.want {
+				t.Fatalf("String = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+	}{
+		{"srt block without timing", FormatSRT, "1\nHello\n"},
+		{"vtt without header", FormatVTT, "00:01.000 --> 00:02.000\nHi\n"},
+		{"timing after two lines", FormatSRT, "1\nextra\n00:00:01,000 --> 00:00:02,000\nHi\n"},
+		{"no cues", FormatVTT, "WEBVTT\n\nNOTE only a note\n"},
+		{"empty", FormatSRT, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.format, tt.data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestSetText(t *testing.T) {
+	f, err := Parse(FormatSRT, "1\n00:00:01,000 --> 00:00:02,000\nHello\n\n2\n00:00:03,000 --> 00:00:04,000\nWorld\n")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if err := f.SetText([][]string{{"你好"}}); err == nil {
+		t.Fatal("expected an error for a cue count mismatch")
+	}
+	if err := f.SetText([][]string{{"你好"}, {"世界", "第二行"}}); err != nil {
+		t.Fatalf("SetText: %v", err)
+	}
+	want := "1\n00:00:01,000 --> 00:00:02,000\n你好\n\n2\n00:00:03,000 --> 00:00:04,000\n世界\n第二行\n"
+	if got := f.String(); got != want {
+		t.Fatalf("String = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	got := EncodeBatch([]*Cue{{Lines: []string{"Hello"}}, {Lines: []string{"Two", "lines"}}})
+	want := "#1\nHello\n#2\nTwo\nlines"
+	if got != want {
+		t.Fatalf("EncodeBatch = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    [][]string
+		wantErr bool
+	}{
+		{"in order", "#1\n你好\n#2\n两\n行", [][]string{{"你好"}, {"两", "行"}}, false},
+		{"reordered with crlf and blanks", "#2\r\n世界\r\n\r\n#1\r\n你好\r\n", [][]string{{"你好"}, {"世界"}}, false},
+		{"text before first marker ignored", "Sure:\n#1\n你好\n#2\n世界", [][]string{{"你好"}, {"世界"}}, false},
+		{"missing cue", "#1\n你好", nil, true},
+		{"duplicate marker", "#1\n你好\n#1\n你好\n#2\n世界", nil, true},
+		{"out of range marker", "#1\n你好\n#2\n世界\n#3\n多余", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeBatch(tt.text, 2)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeBatch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DecodeBatch = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
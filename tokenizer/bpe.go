@@ -0,0 +1,119 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPieceBytes 过长的片段 (如没有空格的整段中文) 按该长度切开后再合并，
+// 避免逐对合并的平方复杂度；切分处最多多算一个 token
+const maxPieceBytes = 256
+
+// 各编码的预分词正则。RE2 不支持 tiktoken 原正则中的 \s+(?!\S)，直接用 \s+ 代替，只影响空白的切分
+var splitPatterns = map[string]string{
+	"cl100k_base": `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`,
+	"o200k_base": `[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+		`|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+`,
+}
+
+// BPE 读取 tiktoken 格式 (每行为 base64 编码的 token 与其合并优先级) 的字节级 BPE 编码，只用于计数
+type BPE struct {
+	name    string
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// LoadBPE 从 tiktoken 文件加载编码，name 决定使用的预分词正则
+func LoadBPE(name, path string) (*BPE, error) {
+	expr, ok := splitPatterns[name]
+	if !ok {
+		return nil, fmt.Errorf("tokenizer: unknown encoding %q", name)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		token, rank, found := strings.Cut(text, " ")
+		if !found {
+			return nil, fmt.Errorf("tokenizer: %s:%d: malformed line", path, line)
+		}
+		data, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer: %s:%d: %w", path, line, err)
+		}
+		r, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer: %s:%d: %w", path, line, err)
+		}
+		ranks[string(data)] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("tokenizer: %s is empty", path)
+	}
+	return &BPE{name: name, ranks: ranks, pattern: regexp.MustCompile(expr)}, nil
+}
+
+// Name 编码名称，例如 cl100k_base
+func (b *BPE) Name() string { return b.name }
+
+// Count 返回文本编码后的 token 数
+func (b *BPE) Count(text string) int {
+	count := 0
+	for _, piece := range b.pattern.FindAllString(text, -1) {
+		for len(piece) > maxPieceBytes {
+			cut := maxPieceBytes
+			for cut > 0 && !utf8.RuneStart(piece[cut]) {
+				cut--
+			}
+			count += b.countPiece(piece[:cut])
+			piece = piece[cut:]
+		}
+		count += b.countPiece(piece)
+	}
+	return count
+}
+
+// countPiece 对一个预分词片段做字节对合并：每次合并优先级最高 (rank 最小) 的相邻两段，直到无法合并
+func (b *BPE) countPiece(piece string) int {
+	if _, ok := b.ranks[piece]; ok {
+		return 1
+	}
+	// bounds[i] 为第 i 段的起始字节位置
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,67 @@
+package tokenizer
+
+import "strings"
+
+// DefaultContextWindow 未知模型的上下文窗口，按常见本地模型的较小值估算
+const DefaultContextWindow = 8192
+
+// ModelInfo 模型使用的编码与上下文窗口，Encoding 为空表示分词器未公开，只能估算
+type ModelInfo struct {
+	Encoding      string
+	ContextWindow int
+}
+
+// knownModels 按模型名前缀匹配，较长的前缀优先
+var knownModels = map[string]ModelInfo{
+	"gpt-4o":        {"o200k_base", 128000},
+	"gpt-4.1":       {"o200k_base", 1047576},
+	"gpt-5":         {"o200k_base", 400000},
+	"o1":            {"o200k_base", 200000},
+	"o3":            {"o200k_base", 200000},
+	"o4":            {"o200k_base", 200000},
+	"gpt-4-turbo":   {"cl100k_base", 128000},
+	"gpt-4":         {"cl100k_base", 8192},
+	"gpt-4-32k":     {"cl100k_base", 32768},
+	"gpt-3.5-turbo": {"cl100k_base", 16385},
+	"claude":        {"", 200000},
+	"gemini":        {"", 1048576},
+	"llama3":        {"", 8192},
+	"llama3.1":      {"", 131072},
+	"llama-3":       {"", 8192},
+	"llama-3.1":     {"", 131072},
+	"qwen":          {"", 32768},
+	"mistral":       {"", 32768},
+	"deepseek":      {"", 65536},
+}
+
+// Lookup 返回模型的编码与上下文窗口，未知模型返回 DefaultContextWindow
+func Lookup(model string) ModelInfo {
+	if info, ok := matchPrefix(knownModels, normalizeModel(model)); ok {
+		return info
+	}
+	return ModelInfo{ContextWindow: DefaultContextWindow}
+}
+
+// normalizeModel 去掉 OpenRouter 等聚合服务的厂商前缀 (openai/gpt-4o) 与 Ollama 的标签 (llama3:8b)
+func normalizeModel(model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	if name, _, found := strings.Cut(model, ":"); found {
+		model = name
+	}
+	return model
+}
+
+// matchPrefix 返回最长匹配前缀对应的值
+func matchPrefix[T any](table map[string]T, model string) (T, bool) {
+	var best T
+	bestLen := -1
+	for prefix, value := range table {
+		if strings.HasPrefix(model, strings.ToLower(prefix)) && len(prefix) > bestLen {
+			best, bestLen = value, len(prefix)
+		}
+	}
+	return best, bestLen >= 0
+}
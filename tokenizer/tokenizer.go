@@ -0,0 +1,118 @@
+package tokenizer
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MessageOverhead 每条消息除内容外的固定开销 (角色、分隔符等)
+	MessageOverhead = 4
+	// ImageTokens 一张图片大致占用的 token 数，各家计算方式不同，按较大的值估算
+	ImageTokens = 1000
+)
+
+// Encoder 文本的 token 计数
+type Encoder interface {
+	Name() string
+	Count(text string) int
+}
+
+// Counter 按模型选择编码计数，并提供模型的上下文窗口大小。
+// 没有对应的 BPE 文件或模型使用未公开的分词器时，退回到按字符类别估算；零值只做估算
+type Counter struct {
+	encodings map[string]Encoder
+	windows   map[string]int
+}
+
+// NewCounter 加载 dir 中的 <编码名>.tiktoken 文件，windows 覆盖内置的模型上下文窗口 (按模型名前缀匹配)
+func NewCounter(dir string, windows map[string]int) *Counter {
+	c := &Counter{encodings: make(map[string]Encoder), windows: windows}
+	var missing []string
+	for name := range splitPatterns {
+		path := filepath.Join(dir, name+".tiktoken")
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, path)
+			continue
+		}
+		bpe, err := LoadBPE(name, path)
+		if err != nil {
+			log.Printf("Warning: Could not load tokenizer %s: %v", path, err)
+			continue
+		}
+		c.encodings[name] = bpe
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		log.Printf("Warning: tokenizer files not found: %s. Token counts for OpenAI models will be estimated "+
+			"and long conversations may exceed the context window; download them as described in README.", strings.Join(missing, ", "))
+	}
+	return c
+}
+
+// Encodings 已加载的编码名称
+func (c *Counter) Encodings() []string {
+	var names []string
+	for name := range c.encodings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Count 返回文本在该模型下的 token 数
+func (c *Counter) Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	if enc, ok := c.encodings[Lookup(model).Encoding]; ok {
+		return enc.Count(text)
+	}
+	return Estimate(text)
+}
+
+// ContextWindow 返回模型的上下文窗口大小 (tokens)
+func (c *Counter) ContextWindow(model string) int {
+	if window, ok := matchPrefix(c.windows, normalizeModel(model)); ok && window > 0 {
+		return window
+	}
+	return Lookup(model).ContextWindow
+}
+
+// Estimate 没有分词表时的估算：中日韩文字约每字 1 个 token，
+// 其他文字的单词约每 4 个字符 1 个 token，标点符号各算 1 个
+func Estimate(text string) int {
+	count, word := 0, 0
+	flush := func() {
+		count += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			count++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			count++
+		}
+	}
+	flush()
+	return count
+}
+
+// String 日志用的简要说明
+func (c *Counter) String() string {
+	if len(c.encodings) == 0 {
+		return "heuristic estimate"
+	}
+	return strings.Join(c.Encodings(), ", ") + " (others estimated)"
+}
@@ -0,0 +1,128 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTable 写入一个合成的 tiktoken 文件：256 个单字节 token 加上按顺序排列的合并结果
+func writeTable(t *testing.T, dir, name string, merges ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for i := 0; i < 256; i++ {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte{byte(i)}), i)
+	}
+	for i, m := range merges {
+		fmt.Fprintf(&b, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(m)), 256+i)
+	}
+	path := filepath.Join(dir, name+".tiktoken")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBPECount(t *testing.T) {
+	path := writeTable(t, t.TempDir(), "cl100k_base", "he", "ll", "llo", "hello", "aa", " w", " wo")
+	bpe, err := LoadBPE("cl100k_base", path)
+	if err != nil {
+		t.Fatalf("LoadBPE: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"whole piece in table", "hello", 1},
+		{"merges applied by rank", "hell", 2},                      // he + ll
+		{"unmerged bytes", "xyz", 3},                               // 没有合并规则
+		{"split into pieces", "hello world", 5},                    // hello | " wo" r l d
+		{"multibyte runes", "你好", 6},                               // 每个汉字 3 个字节
+		{"long piece cut at limit", strings.Repeat("a", 300), 150}, // 256 字节切开后各自两两合并
+		{"digits grouped by three", "12345", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bpe.Count(tt.text); got != tt.want {
+				t.Fatalf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadBPEErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadBPE("unknown", writeTable(t, dir, "unknown")); err == nil {
+		t.Fatal("expected an error for an unknown encoding")
+	}
+	malformed := filepath.Join(dir, "malformed.tiktoken")
+	os.WriteFile(malformed, []byte("YQ==\n"), 0o644)
+	if _, err := LoadBPE("cl100k_base", malformed); err == nil {
+		t.Fatal("expected an error for a line without rank")
+	}
+	empty := filepath.Join(dir, "empty.tiktoken")
+	os.WriteFile(empty, nil, 0o644)
+	if _, err := LoadBPE("cl100k_base", empty); err == nil {
+		t.Fatal("expected an error for an empty file")
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"你好世界", 4},
+		{"こんにちは", 5},
+		{"hello", 2},
+		{"abcd efgh", 2},
+		{"hello, world!", 6},
+		{"中文 mixed 文本", 6},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	dir := t.TempDir()
+	writeTable(t, dir, "cl100k_base", "he", "ll", "llo", "hello")
+	c := NewCounter(dir, map[string]int{"llama3": 65536})
+
+	if got := c.Encodings(); len(got) != 1 || got[0] != "cl100k_base" {
+		t.Fatalf("unexpected encodings %v", got)
+	}
+	if got := c.Count("gpt-4", "hello"); got != 1 {
+		t.Fatalf("gpt-4 should use the loaded BPE, got %d", got)
+	}
+	// o200k_base 未加载，以及分词器未公开的模型都退回到估算
+	if got := c.Count("gpt-4o", "hello"); got != Estimate("hello") {
+		t.Fatalf("gpt-4o should be estimated, got %d", got)
+	}
+	if got := c.Count("claude-3-5-sonnet", "hello"); got != Estimate("hello") {
+		t.Fatalf("claude should be estimated, got %d", got)
+	}
+	var zero Counter
+	if got := zero.Count("gpt-4", "hello"); got != Estimate("hello") {
+		t.Fatalf("zero Counter should estimate, got %d", got)
+	}
+
+	if got := c.ContextWindow("ollama/llama3:8b"); got != 65536 {
+		t.Fatalf("configured window should override the built-in one, got %d", got)
+	}
+	if got := c.ContextWindow("openai/gpt-4o-mini"); got != 128000 {
+		t.Fatalf("unexpected gpt-4o window %d", got)
+	}
+	if got := c.ContextWindow("some-unknown-model"); got != DefaultContextWindow {
+		t.Fatalf("unknown models should use the default window, got %d", got)
+	}
+}
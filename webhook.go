@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"tg-bot-go/config"
+	"tg-bot-go/logger"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// startWebhook 注册 Webhook 并启动 HTTP 服务，收到的更新写入返回的通道。
+// ctx 结束后不再接收新的更新，返回 503 让 Telegram 稍后重发
+func startWebhook(ctx context.Context, bot *tgbotapi.BotAPI, cfg config.TelegramConfig) (tgbotapi.UpdatesChannel, *http.Server, error) {
+	if cfg.WebhookURL == "" {
+		return nil, nil, fmt.Errorf("TELEGRAM_WEBHOOK_URL is not set")
+	}
+	if cfg.WebhookSecret == "" {
+		return nil, nil, fmt.Errorf("TELEGRAM_WEBHOOK_SECRET is not set")
+	}
+	webhookURL, err := url.Parse(cfg.WebhookURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid webhook url: %w", err)
+	}
+
+	updates := make(chan tgbotapi.Update, bot.Buffer)
+
+	path := webhookURL.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		secret := r.Header.Get(webhookSecretHeader)
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.WebhookSecret)) != 1 {
+			logger.LogRuntime(fmt.Sprintf("Rejected webhook request from %s: invalid secret token", r.RemoteAddr))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			logger.LogRuntime(fmt.Sprintf("Failed to decode webhook update: %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// 只有写入通道的更新才返回 200，否则 Telegram 会认为已送达而不再重发
+		select {
+		case <-ctx.Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// 注册 Webhook，secret_token 会由 Telegram 放在每个请求的请求头中
+	params := tgbotapi.Params{"url": webhookURL.String()}
+	params.AddNonEmpty("secret_token", cfg.WebhookSecret)
+	if _, err := bot.MakeRequest("setWebhook", params); err != nil {
+		return nil, nil, fmt.Errorf("set webhook: %w", err)
+	}
+
+	server := &http.Server{
+		Addr:    cfg.WebhookListen,
+		Handler: mux,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.LogRuntime(fmt.Sprintf("Webhook server error: %v", err))
+		}
+	}()
+
+	logger.LogRuntime(fmt.Sprintf("Webhook server listening on %s, path %s", cfg.WebhookListen, path))
+	return updates, server, nil
+}